@@ -17,6 +17,9 @@ const supabench_uri = __ENV.SUPABENCH_URI
 export function handleSummary(data) {
   console.log('Preparing the end-of-test summary...')
   const started = Date.now()
+  // the summary is handled right after the load ends
+  const loadEnded = started
+  const loadStarted = loadEnded - parseInt(data.state.testRunDurationMs)
 
   // Send the results to remote server
   if (!run) {
@@ -31,6 +34,8 @@ export function handleSummary(data) {
       ended_at: `${
         started + parseInt(data.state.testRunDurationMs) + 60 * 1000
       }`,
+      load_started_at: `${loadStarted}`,
+      load_ended_at: `${loadEnded}`,
     }
 
     const resp = http.post(
@@ -55,6 +60,8 @@ export function handleSummary(data) {
       ended_at: `${
         started + parseInt(data.state.testRunDurationMs) + 15 * 1000
       }`,
+      load_started_at: `${loadStarted}`,
+      load_ended_at: `${loadEnded}`,
     }
 
     const resp = http.patch(
@@ -1,8 +1,12 @@
 package archive
 
 import (
+	"archive/tar"
 	"context"
+	"errors"
+	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
@@ -10,7 +14,35 @@ import (
 	"github.com/mholt/archiver/v4"
 )
 
-func Unpack(ctx context.Context, sourceFile string, targetPath string) error {
+// Limits bound what an archive may expand to.
+type Limits struct {
+	// MaxFiles is the maximum number of entries in the archive.
+	MaxFiles int
+	// MaxSize is the maximum total uncompressed size in bytes.
+	MaxSize int64
+}
+
+// DefaultLimits are generous enough for any terraform benchmark while still
+// protecting the host from archive bombs.
+var DefaultLimits = Limits{
+	MaxFiles: 10000,
+	MaxSize:  512 << 20,
+}
+
+var (
+	ErrTooManyFiles = errors.New("archive contains too many files")
+	ErrTooLarge     = errors.New("archive is too large when uncompressed")
+)
+
+type symlink struct {
+	path   string
+	target string
+}
+
+// Unpack extracts sourceFile into targetPath. Entries escaping targetPath,
+// absolute paths, hard links and symlinks pointing outside of targetPath are
+// rejected. File permissions are preserved so scripts stay executable.
+func Unpack(ctx context.Context, sourceFile string, targetPath string, limits Limits) error {
 	source, err := os.Open(sourceFile)
 	if err != nil {
 		return err
@@ -21,18 +53,72 @@ func Unpack(ctx context.Context, sourceFile string, targetPath string) error {
 	if err != nil {
 		return err
 	}
+	extractor, ok := format.(archiver.Extractor)
+	if !ok {
+		return fmt.Errorf("unsupported archive format %s", format.Name())
+	}
 
-	err = format.(archiver.Extractor).Extract(ctx, reader, nil, func(ctx context.Context, f archiver.File) error {
+	root, err := filepath.Abs(targetPath)
+	if err != nil {
+		return err
+	}
+
+	files := 0
+	var size int64
+	// symlinks are created after all files are written, so that no write
+	// can ever be redirected through a link
+	links := []symlink{}
+
+	err = extractor.Extract(ctx, reader, nil, func(ctx context.Context, f archiver.File) error {
 		if strings.Contains(f.NameInArchive, "__MACOSX") {
 			return nil
 		}
 
-		wp := filepath.Join(targetPath, f.NameInArchive)
+		files++
+		if limits.MaxFiles > 0 && files > limits.MaxFiles {
+			return ErrTooManyFiles
+		}
+
+		wp, err := safeJoin(root, f.NameInArchive)
+		if err != nil {
+			return err
+		}
+
+		if hdr, ok := f.Header.(*tar.Header); ok && hdr.Typeflag == tar.TypeLink {
+			return fmt.Errorf("hard links are not supported: %s", f.NameInArchive)
+		}
 
 		if f.IsDir() {
-			if err := os.MkdirAll(wp, os.ModePerm); err != nil {
+			return os.MkdirAll(wp, 0755)
+		}
+		if err := os.MkdirAll(filepath.Dir(wp), 0755); err != nil {
+			return err
+		}
+
+		if f.Mode()&fs.ModeSymlink != 0 {
+			target := f.LinkTarget
+			if target == "" && f.Open != nil {
+				// zip stores the link target as the file content
+				rc, err := f.Open()
+				if err != nil {
+					return err
+				}
+				b, err := io.ReadAll(io.LimitReader(rc, 4096))
+				rc.Close()
+				if err != nil {
+					return err
+				}
+				target = string(b)
+			}
+			if err := checkLinkTarget(root, wp, target); err != nil {
 				return err
 			}
+			links = append(links, symlink{path: wp, target: target})
+			return nil
+		}
+
+		if !f.Mode().IsRegular() {
+			// devices, pipes and sockets have no business in a benchmark
 			return nil
 		}
 
@@ -42,20 +128,83 @@ func Unpack(ctx context.Context, sourceFile string, targetPath string) error {
 		}
 		defer rc.Close()
 
-		wf, err := os.Create(wp)
+		perm := f.Mode().Perm()&0755 | 0600
+		wf, err := os.OpenFile(wp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, perm)
 		if err != nil {
 			return err
 		}
 		defer wf.Close()
 
-		if _, err := io.Copy(wf, rc); err != nil {
+		var src io.Reader = rc
+		if limits.MaxSize > 0 {
+			src = io.LimitReader(rc, limits.MaxSize-size+1)
+		}
+		n, err := io.Copy(wf, src)
+		if err != nil {
 			return err
 		}
+		size += n
+		if limits.MaxSize > 0 && size > limits.MaxSize {
+			return ErrTooLarge
+		}
 
 		return nil
 	})
 	if err != nil {
 		return err
 	}
+
+	for _, l := range links {
+		if err := os.Symlink(l.target, l.path); err != nil {
+			return err
+		}
+	}
+	// make sure links do not escape through other links
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return err
+	}
+	for _, l := range links {
+		resolved, err := filepath.EvalSymlinks(l.path)
+		if err != nil {
+			// dangling links cannot be used to read anything
+			continue
+		}
+		if !within(realRoot, resolved) {
+			return fmt.Errorf("symlink %s points outside of the archive", l.path)
+		}
+	}
+
+	return nil
+}
+
+// safeJoin joins name onto root and fails if the result escapes root.
+func safeJoin(root, name string) (string, error) {
+	if name == "" || filepath.IsAbs(name) || strings.HasPrefix(name, "/") || strings.HasPrefix(name, `\`) {
+		return "", fmt.Errorf("illegal path in archive: %q", name)
+	}
+	wp := filepath.Join(root, filepath.FromSlash(name))
+	if !within(root, wp) {
+		return "", fmt.Errorf("illegal path in archive: %q", name)
+	}
+	return wp, nil
+}
+
+func checkLinkTarget(root, link, target string) error {
+	if target == "" || filepath.IsAbs(target) {
+		return fmt.Errorf("illegal symlink target %q for %s", target, link)
+	}
+	resolved := filepath.Join(filepath.Dir(link), filepath.FromSlash(target))
+	if !within(root, resolved) {
+		return fmt.Errorf("illegal symlink target %q for %s", target, link)
+	}
 	return nil
 }
+
+func within(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
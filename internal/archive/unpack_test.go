@@ -0,0 +1,283 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type entry struct {
+	name string
+	body string
+	mode int64
+	// typ is the tar type of the entry, regular files by default
+	typ  byte
+	link string
+}
+
+func writeTar(t *testing.T, name string, entries []entry) {
+	t.Helper()
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	w := tar.NewWriter(f)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Mode: e.mode, Typeflag: e.typ, Linkname: e.link}
+		if hdr.Mode == 0 {
+			hdr.Mode = 0644
+		}
+		if hdr.Typeflag == 0 {
+			hdr.Typeflag = tar.TypeReg
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			hdr.Size = int64(len(e.body))
+		}
+		if err := w.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(e.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeZip(t *testing.T, name string, entries []entry) {
+	t.Helper()
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	w := zip.NewWriter(f)
+	for _, e := range entries {
+		hdr := &zip.FileHeader{Name: e.name, Method: zip.Deflate}
+		mode := fs.FileMode(e.mode)
+		if mode == 0 {
+			mode = 0644
+		}
+		body := e.body
+		if e.typ == tar.TypeSymlink {
+			// zip stores the link target as the content
+			mode |= fs.ModeSymlink
+			body = e.link
+		}
+		hdr.SetMode(mode)
+		fw, err := w.CreateHeader(hdr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fw.Write([]byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUnpack(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		entries []entry
+		limits  Limits
+		// wantErr is matched with errors.Is, wantErrText as a substring
+		wantErr     error
+		wantErrText string
+		check       func(t *testing.T, dir string)
+	}{
+		{
+			name:   "tar",
+			format: "tar",
+			entries: []entry{
+				{name: "main.tf", body: "terraform {}"},
+				{name: "scripts/", typ: tar.TypeDir, mode: 0755},
+				{name: "scripts/run.sh", body: "#!/bin/sh", mode: 0755},
+				{name: "scripts/current", typ: tar.TypeSymlink, link: "run.sh"},
+				{name: "up", typ: tar.TypeSymlink, link: "scripts/../main.tf"},
+			},
+			limits: DefaultLimits,
+			check: func(t *testing.T, dir string) {
+				assertFile(t, filepath.Join(dir, "main.tf"), "terraform {}")
+				assertFile(t, filepath.Join(dir, "scripts/current"), "#!/bin/sh")
+				assertFile(t, filepath.Join(dir, "up"), "terraform {}")
+				info, err := os.Stat(filepath.Join(dir, "scripts/run.sh"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if info.Mode().Perm()&0100 == 0 {
+					t.Errorf("scripts/run.sh mode = %s, want executable", info.Mode())
+				}
+			},
+		},
+		{
+			name:   "zip",
+			format: "zip",
+			entries: []entry{
+				{name: "main.tf", body: "terraform {}"},
+				{name: "__MACOSX/._main.tf", body: "resource fork"},
+				{name: "link.tf", typ: tar.TypeSymlink, link: "main.tf"},
+			},
+			limits: DefaultLimits,
+			check: func(t *testing.T, dir string) {
+				assertFile(t, filepath.Join(dir, "link.tf"), "terraform {}")
+				if _, err := os.Stat(filepath.Join(dir, "__MACOSX")); !os.IsNotExist(err) {
+					t.Errorf("__MACOSX was unpacked")
+				}
+			},
+		},
+		{
+			name:        "parent dir entry",
+			format:      "tar",
+			entries:     []entry{{name: "../evil.tf", body: "x"}},
+			limits:      DefaultLimits,
+			wantErrText: "illegal path",
+		},
+		{
+			name:        "nested parent dir entry",
+			format:      "zip",
+			entries:     []entry{{name: "modules/../../evil.tf", body: "x"}},
+			limits:      DefaultLimits,
+			wantErrText: "illegal path",
+		},
+		{
+			name:        "absolute path",
+			format:      "tar",
+			entries:     []entry{{name: "/tmp/evil.tf", body: "x"}},
+			limits:      DefaultLimits,
+			wantErrText: "illegal path",
+		},
+		{
+			name:        "absolute symlink",
+			format:      "tar",
+			entries:     []entry{{name: "passwd", typ: tar.TypeSymlink, link: "/etc/passwd"}},
+			limits:      DefaultLimits,
+			wantErrText: "illegal symlink target",
+		},
+		{
+			name:        "escaping symlink",
+			format:      "tar",
+			entries:     []entry{{name: "dir/out", typ: tar.TypeSymlink, link: "../../outside"}},
+			limits:      DefaultLimits,
+			wantErrText: "illegal symlink target",
+		},
+		{
+			name:        "escaping zip symlink",
+			format:      "zip",
+			entries:     []entry{{name: "out", typ: tar.TypeSymlink, link: "../outside"}},
+			limits:      DefaultLimits,
+			wantErrText: "illegal symlink target",
+		},
+		{
+			name:   "write through symlink",
+			format: "tar",
+			entries: []entry{
+				{name: "dir", typ: tar.TypeSymlink, link: "."},
+				{name: "dir/main.tf", body: "x"},
+			},
+			limits:      DefaultLimits,
+			wantErrText: "file exists",
+		},
+		{
+			name:   "hard link",
+			format: "tar",
+			entries: []entry{
+				{name: "main.tf", body: "terraform {}"},
+				{name: "copy.tf", typ: tar.TypeLink, link: "main.tf"},
+			},
+			limits:      DefaultLimits,
+			wantErrText: "hard links are not supported",
+		},
+		{
+			name:   "too many files",
+			format: "tar",
+			entries: []entry{
+				{name: "a.tf", body: "a"},
+				{name: "b.tf", body: "b"},
+				{name: "c.tf", body: "c"},
+			},
+			limits:  Limits{MaxFiles: 2},
+			wantErr: ErrTooManyFiles,
+		},
+		{
+			name:   "too large",
+			format: "zip",
+			entries: []entry{
+				{name: "a.tf", body: strings.Repeat("a", 60)},
+				{name: "b.tf", body: strings.Repeat("b", 60)},
+			},
+			limits:  Limits{MaxSize: 100},
+			wantErr: ErrTooLarge,
+		},
+		{
+			name:   "at the limits",
+			format: "tar",
+			entries: []entry{
+				{name: "a.tf", body: strings.Repeat("a", 50)},
+				{name: "b.tf", body: strings.Repeat("b", 50)},
+			},
+			limits: Limits{MaxFiles: 2, MaxSize: 100},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			src := filepath.Join(dir, "script."+tt.format)
+			switch tt.format {
+			case "tar":
+				writeTar(t, src, tt.entries)
+			case "zip":
+				writeZip(t, src, tt.entries)
+			}
+			target := filepath.Join(dir, "unpacked")
+			if err := os.Mkdir(target, 0755); err != nil {
+				t.Fatal(err)
+			}
+
+			err := Unpack(context.Background(), src, target, tt.limits)
+			switch {
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Unpack() error = %v, want %v", err, tt.wantErr)
+				}
+			case tt.wantErrText != "":
+				if err == nil || !strings.Contains(err.Error(), tt.wantErrText) {
+					t.Fatalf("Unpack() error = %v, want %q", err, tt.wantErrText)
+				}
+			case err != nil:
+				t.Fatalf("Unpack() error = %v", err)
+			}
+			if _, err := os.Stat(filepath.Join(dir, "evil.tf")); err == nil {
+				t.Errorf("entry was written outside of the target dir")
+			}
+			if tt.check != nil {
+				tt.check(t, target)
+			}
+		})
+	}
+}
+
+func assertFile(t *testing.T, name, want string) {
+	t.Helper()
+	b, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != want {
+		t.Errorf("%s = %q, want %q", name, b, want)
+	}
+}
@@ -0,0 +1,67 @@
+package backup
+
+import (
+	"errors"
+
+	"github.com/labstack/echo/v5"
+	"github.com/pocketbase/pocketbase/tools/types"
+	"github.com/rs/zerolog/log"
+	"github.com/supabase/supabench/internal/execution"
+)
+
+// ExportHandler streams projects, benchmarks and finished runs as JSON
+// lines, optionally limited with the project, benchmark and since query
+// params.
+func ExportHandler(app *execution.App) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		filter := execution.ExportFilter{
+			Project:   c.QueryParam("project"),
+			Benchmark: c.QueryParam("benchmark"),
+		}
+		if since := c.QueryParam("since"); since != "" {
+			t, err := types.ParseDateTime(since)
+			if err != nil {
+				return c.JSON(400, map[string]string{"error": "invalid since: " + err.Error()})
+			}
+			filter.Since = t
+		}
+
+		c.Response().Header().Set(echo.HeaderContentType, "application/x-ndjson")
+		c.Response().Header().Set(echo.HeaderContentDisposition, `attachment; filename="supabench-export.jsonl"`)
+		c.Response().WriteHeader(200)
+		if err := app.Export(c.Response(), filter); err != nil {
+			// the status is sent already, a truncated export fails on import
+			log.Error().Err(err).Msg("error exporting")
+		}
+		return nil
+	}
+}
+
+// ImportHandler imports an export from the request body. The owner query
+// param is the email of the user that owns created projects and
+// benchmarks, conflict is skip, overwrite or fail and dry_run=true only
+// reports what would be imported.
+func ImportHandler(app *execution.App) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		opts := execution.ImportOptions{
+			Conflict: c.QueryParam("conflict"),
+			DryRun:   c.QueryParam("dry_run") == "true",
+		}
+		if email := c.QueryParam("owner"); email != "" {
+			owner, err := app.PB.Dao().FindUserByEmail(email)
+			if err != nil {
+				return c.JSON(400, map[string]string{"error": "owner not found: " + email})
+			}
+			opts.OwnerID = owner.Id
+		}
+
+		result, err := app.Import(c.Request().Body, opts)
+		if errors.Is(err, execution.ErrImportConflict) {
+			return c.JSON(409, map[string]string{"error": err.Error()})
+		}
+		if err != nil {
+			return c.JSON(400, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(200, result)
+	}
+}
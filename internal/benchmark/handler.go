@@ -0,0 +1,25 @@
+package benchmark
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/labstack/echo/v5"
+	"github.com/supabase/supabench/internal/execution"
+)
+
+// VariablesHandler returns the terraform variables declared by the
+// benchmark script, so that clients can build a form for new runs.
+func VariablesHandler(app *execution.App) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		vars, err := app.BenchmarkVariables(c.PathParam("id"))
+		if errors.Is(err, sql.ErrNoRows) {
+			return c.JSON(404, map[string]string{"error": "benchmark script not found"})
+		}
+		if err != nil {
+			return c.JSON(500, map[string]string{"error": err.Error()})
+		}
+
+		return c.JSON(200, vars)
+	}
+}
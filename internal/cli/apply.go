@@ -0,0 +1,130 @@
+package cli
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/supabase/supabench/internal/execution"
+	"github.com/supabase/supabench/models"
+)
+
+func applyCommand() *cobra.Command {
+	var (
+		flags  clientFlags
+		file   string
+		dryRun bool
+	)
+	cmd := &cobra.Command{
+		Use:   "apply -f <manifest>",
+		Short: "Create or update projects and benchmarks from a manifest",
+		Long: `Create or update the projects, benchmarks, thresholds, scripts and
+non-secret vars described by a YAML manifest. Nothing is deleted and secret
+env is never part of a manifest.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if file == "" {
+				return errors.New("--file is required")
+			}
+			b, err := os.ReadFile(file)
+			if err != nil {
+				return err
+			}
+			m, err := execution.ParseManifest(b)
+			if err != nil {
+				return err
+			}
+
+			c := flags.client()
+			result, err := c.Apply(cmd.Context(), m, dryRun)
+			if err != nil {
+				return err
+			}
+
+			out := cmd.OutOrStdout()
+			tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "ACTION\tKIND\tSLUG\tFIELDS")
+			for _, change := range result.Changes {
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", change.Action, change.Kind, change.Slug, strings.Join(change.Fields, ", "))
+			}
+			if err := applyScripts(cmd, c, tw, m, result, filepath.Dir(file), dryRun); err != nil {
+				tw.Flush()
+				return err
+			}
+			if err := tw.Flush(); err != nil {
+				return err
+			}
+			if dryRun {
+				fmt.Fprintln(out, "\ndry run, nothing was changed")
+			}
+			return nil
+		},
+	}
+	flags.register(cmd)
+	cmd.Flags().StringVarP(&file, "file", "f", "", "manifest file")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "only print the changes")
+	return cmd
+}
+
+// applyScripts uploads the scripts of the manifest that differ from the
+// ones on the server. Script paths are relative to the manifest.
+func applyScripts(cmd *cobra.Command, c *Client, w io.Writer, m *models.Manifest, result *models.ManifestResult, dir string, dryRun bool) error {
+	scripts := map[string]models.ManifestScript{}
+	for _, s := range result.Scripts {
+		scripts[s.Benchmark] = s
+	}
+
+	for _, p := range m.Projects {
+		for _, b := range p.Benchmarks {
+			if b.Script == nil {
+				continue
+			}
+			name := *b.Script
+			if !filepath.IsAbs(name) {
+				name = filepath.Join(dir, name)
+			}
+			hash, err := hashFile(name)
+			if err != nil {
+				return err
+			}
+
+			action := "upload"
+			s := scripts[b.Slug]
+			if s.Hash == hash {
+				action = execution.ActionUnchanged
+			}
+			fmt.Fprintf(w, "%s\tscript\t%s\t%s\n", action, b.Slug, filepath.Base(name))
+			if dryRun || action != "upload" {
+				continue
+			}
+			if s.SecretID == "" {
+				return fmt.Errorf("benchmark %s: no secret to upload the script to", b.Slug)
+			}
+			if err := c.UploadScript(cmd.Context(), s.SecretID, name, "supabench apply"); err != nil {
+				return fmt.Errorf("benchmark %s: %w", b.Slug, err)
+			}
+		}
+	}
+	return nil
+}
+
+func hashFile(name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,150 @@
+package cli
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+func exportCommand() *cobra.Command {
+	var (
+		flags     clientFlags
+		output    string
+		project   string
+		benchmark string
+		since     string
+	)
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export projects, benchmarks and finished runs",
+		Long: `Export projects, benchmarks and finished runs with their raw data, vars,
+events and PR links as JSON lines. Secrets are not exported. Output files
+ending in .gz are compressed.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			q := url.Values{}
+			if project != "" {
+				q.Set("project", project)
+			}
+			if benchmark != "" {
+				q.Set("benchmark", benchmark)
+			}
+			if since != "" {
+				q.Set("since", since)
+			}
+
+			if output == "" || output == "-" {
+				return flags.client().Export(cmd.Context(), q, cmd.OutOrStdout())
+			}
+			f, err := os.Create(output)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			var w io.WriteCloser = f
+			if strings.HasSuffix(output, ".gz") {
+				w = gzip.NewWriter(f)
+			}
+			if err := flags.client().Export(cmd.Context(), q, w); err != nil {
+				return err
+			}
+			if err := w.Close(); err != nil {
+				return err
+			}
+			return f.Close()
+		},
+	}
+	flags.register(cmd)
+	cmd.Flags().StringVarP(&output, "output", "o", "", "output file, stdout by default")
+	cmd.Flags().StringVar(&project, "project", "", "only export the project with this slug")
+	cmd.Flags().StringVar(&benchmark, "benchmark", "", "only export the benchmark with this slug")
+	cmd.Flags().StringVar(&since, "since", "", "only export runs triggered since, e.g. 2024-01-01 00:00:00.000Z")
+	return cmd
+}
+
+func importCommand() *cobra.Command {
+	var (
+		flags    clientFlags
+		file     string
+		owner    string
+		conflict string
+		dryRun   bool
+	)
+	cmd := &cobra.Command{
+		Use:   "import -f <export>",
+		Short: "Import an export of another instance",
+		Long: `Import an export, all or nothing. Projects and benchmarks are matched by
+slug, runs by benchmark, name and trigger time. Records whose IDs are taken get
+new ones. Requires an admin token.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if file == "" {
+				return errors.New("--file is required")
+			}
+			f, err := os.Open(file)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			var r io.Reader = f
+			if strings.HasSuffix(file, ".gz") {
+				gz, err := gzip.NewReader(f)
+				if err != nil {
+					return err
+				}
+				defer gz.Close()
+				r = gz
+			}
+
+			q := url.Values{}
+			if owner != "" {
+				q.Set("owner", owner)
+			}
+			q.Set("conflict", conflict)
+			if dryRun {
+				q.Set("dry_run", "true")
+			}
+			result, err := flags.client().Import(cmd.Context(), r, q)
+			if err != nil {
+				return err
+			}
+
+			kinds := make([]string, 0, len(result.Counts))
+			for kind := range result.Counts {
+				kinds = append(kinds, kind)
+			}
+			sort.Strings(kinds)
+
+			out := cmd.OutOrStdout()
+			tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "KIND\tCREATED\tUPDATED\tSKIPPED\tREMAPPED")
+			for _, kind := range kinds {
+				c := result.Counts[kind]
+				fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\n", kind, c.Created, c.Updated, c.Skipped, c.Remapped)
+			}
+			if err := tw.Flush(); err != nil {
+				return err
+			}
+			if result.DryRun {
+				fmt.Fprintln(out, "\ndry run, nothing was imported")
+			}
+			return nil
+		},
+	}
+	flags.register(cmd)
+	cmd.Flags().StringVarP(&file, "file", "f", "", "export file, .gz files are decompressed")
+	cmd.Flags().StringVar(&owner, "owner", "", "email of the user owning imported projects and benchmarks")
+	cmd.Flags().StringVar(&conflict, "conflict", "skip", "what to do with existing records: skip, overwrite or fail")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "only report what would be imported")
+	return cmd
+}
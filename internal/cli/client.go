@@ -0,0 +1,368 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/supabase/supabench/models"
+)
+
+// Client talks to the supabench API.
+type Client struct {
+	URL   string
+	Token string
+
+	http *http.Client
+	// transfer has no timeout, for exports and imports that may take long
+	transfer *http.Client
+}
+
+// NewClient returns a client for the supabench server at baseURL. Tokens
+// without a scheme are sent as admin tokens, like loaders do.
+func NewClient(baseURL, token string) *Client {
+	return &Client{
+		URL:      strings.TrimRight(baseURL, "/"),
+		Token:    token,
+		http:     &http.Client{Timeout: 30 * time.Second},
+		transfer: &http.Client{},
+	}
+}
+
+// Run is a run as returned by the runs collection API.
+type Run struct {
+	ID          string            `json:"id"`
+	BenchmarkID string            `json:"benchmark_id"`
+	Name        string            `json:"name"`
+	Origin      string            `json:"origin"`
+	Status      string            `json:"status"`
+	Output      string            `json:"output"`
+	Errors      json.RawMessage   `json:"errors"`
+	Raw         json.RawMessage   `json:"raw"`
+	Phases      []Phase           `json:"phases"`
+	Outputs     map[string]string `json:"outputs"`
+	TriggeredAt string            `json:"triggered_at"`
+	FinishedAt  string            `json:"finished_at"`
+	DryRun      bool              `json:"dry_run"`
+	Plan        string            `json:"plan"`
+	Pinned      bool              `json:"pinned"`
+}
+
+// Phase is a step of the run lifecycle.
+type Phase struct {
+	Name      string `json:"name"`
+	StartedAt string `json:"started_at"`
+	EndedAt   string `json:"ended_at"`
+	Error     string `json:"error"`
+}
+
+// RunEvent is a status transition of a run.
+type RunEvent struct {
+	Created    string `json:"created"`
+	FromStatus string `json:"from_status"`
+	ToStatus   string `json:"to_status"`
+	Source     string `json:"source"`
+	Reason     string `json:"reason"`
+}
+
+// Benchmark is a benchmark as returned by the benchmarks collection API.
+type Benchmark struct {
+	ID                string          `json:"id"`
+	ProjectID         string          `json:"project_id"`
+	Name              string          `json:"name"`
+	Slug              string          `json:"slug"`
+	ExtractMetricPath string          `json:"extract_metric_path"`
+	Meta              json.RawMessage `json:"meta"`
+}
+
+// NewRun is the body of POST /api/runs.
+type NewRun struct {
+	BenchmarkID string  `json:"benchmark_id"`
+	Name        string  `json:"name"`
+	Origin      *string `json:"origin,omitempty"`
+	Comment     *string `json:"comment,omitempty"`
+	Vars        *string `json:"vars,omitempty"`
+	Priority    int     `json:"priority,omitempty"`
+	PRLink      string  `json:"pr_link,omitempty"`
+	Supersede   bool    `json:"supersede,omitempty"`
+	DryRun      bool    `json:"dry_run,omitempty"`
+}
+
+type list[T any] struct {
+	Items      []T `json:"items"`
+	TotalPages int `json:"totalPages"`
+}
+
+// CreateRun queues a run. Retries with the same idempotency key return the
+// run created first.
+func (c *Client) CreateRun(ctx context.Context, run NewRun, idempotencyKey string) (*Run, error) {
+	headers := map[string]string{}
+	if idempotencyKey != "" {
+		headers["Idempotency-Key"] = idempotencyKey
+	}
+	var created Run
+	if err := c.do(ctx, http.MethodPost, "/api/runs", run, &created, headers); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+func (c *Client) Run(ctx context.Context, id string) (*Run, error) {
+	var run Run
+	if err := c.do(ctx, http.MethodGet, "/api/collections/runs/records/"+url.PathEscape(id), nil, &run, nil); err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+func (c *Client) RunEvents(ctx context.Context, id string) ([]RunEvent, error) {
+	q := url.Values{}
+	q.Set("filter", fmt.Sprintf("(run_id='%s')", strings.ReplaceAll(id, "'", "")))
+	q.Set("sort", "created")
+	q.Set("perPage", "200")
+
+	var events list[RunEvent]
+	if err := c.do(ctx, http.MethodGet, "/api/collections/run_events/records?"+q.Encode(), nil, &events, nil); err != nil {
+		return nil, err
+	}
+	return events.Items, nil
+}
+
+// CancelRun drops a queued run or interrupts an executing one, which is
+// then torn down by the server.
+func (c *Client) CancelRun(ctx context.Context, id string) (*Run, error) {
+	var run Run
+	if err := c.do(ctx, http.MethodPost, "/api/runs/"+url.PathEscape(id)+"/cancel", nil, &run, nil); err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+// PinRun keeps a run from being compacted or deleted by retention, or
+// releases it again.
+func (c *Client) PinRun(ctx context.Context, id string, pinned bool) (*Run, error) {
+	method := http.MethodPut
+	if !pinned {
+		method = http.MethodDelete
+	}
+	var run Run
+	if err := c.do(ctx, method, "/api/runs/"+url.PathEscape(id)+"/pin", nil, &run, nil); err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+func (c *Client) Benchmark(ctx context.Context, id string) (*Benchmark, error) {
+	var b Benchmark
+	if err := c.do(ctx, http.MethodGet, "/api/collections/benchmarks/records/"+url.PathEscape(id), nil, &b, nil); err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+func (c *Client) Benchmarks(ctx context.Context) ([]Benchmark, error) {
+	benchmarks := []Benchmark{}
+	for page := 1; ; page++ {
+		q := url.Values{}
+		q.Set("sort", "name")
+		q.Set("perPage", "200")
+		q.Set("page", fmt.Sprint(page))
+
+		var l list[Benchmark]
+		if err := c.do(ctx, http.MethodGet, "/api/collections/benchmarks/records?"+q.Encode(), nil, &l, nil); err != nil {
+			return nil, err
+		}
+		benchmarks = append(benchmarks, l.Items...)
+		if page >= l.TotalPages {
+			return benchmarks, nil
+		}
+	}
+}
+
+// Apply creates or updates what the manifest describes. Dry runs only
+// report the changes.
+func (c *Client) Apply(ctx context.Context, m *models.Manifest, dryRun bool) (*models.ManifestResult, error) {
+	path := "/api/apply"
+	if dryRun {
+		path += "?dry_run=true"
+	}
+	var result models.ManifestResult
+	if err := c.do(ctx, http.MethodPost, path, m, &result, nil); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// UploadScript replaces the script of a secret, which records a new script
+// version like uploads in the admin UI do.
+func (c *Client) UploadScript(ctx context.Context, secretID, name, note string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	part, err := w.CreateFormFile("script", filepath.Base(name))
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(part, f); err != nil {
+		return err
+	}
+	if err := w.WriteField("script_note", note); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPatch, c.URL+"/api/collections/secrets/records/"+url.PathEscape(secretID), &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	return c.send(c.transfer, req, nil)
+}
+
+// Export writes an export of the server to w.
+func (c *Client) Export(ctx context.Context, q url.Values, w io.Writer) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.URL+"/api/export?"+q.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	c.authorize(req)
+
+	resp, err := c.transfer.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		b, _ := io.ReadAll(resp.Body)
+		return apiError(resp.StatusCode, b)
+	}
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// Import sends an export read from r to the server.
+func (c *Client) Import(ctx context.Context, r io.Reader, q url.Values) (*models.ImportResult, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.URL+"/api/import?"+q.Encode(), r)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+
+	var result models.ImportResult
+	if err := c.send(c.transfer, req, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (c *Client) do(ctx context.Context, method, path string, body, out interface{}, headers map[string]string) error {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.URL+path, r)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	return c.send(c.http, req, out)
+}
+
+func (c *Client) send(client *http.Client, req *http.Request, out interface{}) error {
+	c.authorize(req)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		return apiError(resp.StatusCode, b)
+	}
+	if out == nil || len(b) == 0 {
+		return nil
+	}
+	return json.Unmarshal(b, out)
+}
+
+func (c *Client) authorize(req *http.Request) {
+	if c.Token == "" {
+		return
+	}
+	token := c.Token
+	if !strings.HasPrefix(token, "Admin ") && !strings.HasPrefix(token, "User ") {
+		token = "Admin " + token
+	}
+	req.Header.Set("Authorization", token)
+}
+
+// APIError is an error response of the server.
+type APIError struct {
+	Status  int
+	Message string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%d: %s", e.Status, e.Message)
+}
+
+// apiError extracts the message of supabench and PocketBase error bodies.
+func apiError(status int, body []byte) error {
+	var e struct {
+		Error   string `json:"error"`
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(body, &e) == nil {
+		if e.Error != "" {
+			return &APIError{Status: status, Message: e.Error}
+		}
+		if e.Message != "" {
+			return &APIError{Status: status, Message: e.Message}
+		}
+	}
+	return &APIError{Status: status, Message: strings.TrimSpace(string(body))}
+}
+
+// temporary reports whether a request may succeed when retried: network
+// errors, rate limits and server errors are, other API errors are not.
+func temporary(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Status >= 500 || apiErr.Status == http.StatusTooManyRequests
+	}
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
@@ -0,0 +1,662 @@
+// Package cli implements the supabench client commands, which trigger and
+// follow runs on a supabench server, e.g. from CI.
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/supabase/supabench/internal/summary"
+	"github.com/supabase/supabench/models"
+)
+
+// Exit codes of the client commands.
+const (
+	ExitPassed    = 0
+	ExitFailed    = 1
+	ExitRegressed = 2
+	ExitTimeout   = 3
+)
+
+// ExitError ends a client command with the given exit code.
+type ExitError struct {
+	Code int
+	Err  error
+}
+
+func (e *ExitError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("exit code %d", e.Code)
+	}
+	return e.Err.Error()
+}
+
+func (e *ExitError) Unwrap() error {
+	return e.Err
+}
+
+// clientCommands are the top level client commands.
+var clientCommands = map[string]bool{
+	"run":       true,
+	"benchmark": true,
+	"compare":   true,
+	"apply":     true,
+	"export":    true,
+	"import":    true,
+}
+
+// AddCommands registers the client commands next to serve.
+func AddCommands(root *cobra.Command) {
+	root.AddCommand(
+		runCommand(),
+		benchmarkCommand(),
+		compareCommand(),
+		applyCommand(),
+		exportCommand(),
+		importCommand(),
+	)
+}
+
+// IsClientCommand reports whether args invoke a client command. Client
+// commands talk to a server and do not need the local app.
+func IsClientCommand(args []string) bool {
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-") {
+			continue
+		}
+		return clientCommands[arg]
+	}
+	return false
+}
+
+// Execute runs the root command and returns the exit code of the process.
+func Execute(root *cobra.Command) int {
+	root.SilenceUsage = true
+	root.SilenceErrors = true
+	if err := root.Execute(); err != nil {
+		var exit *ExitError
+		if errors.As(err, &exit) {
+			if exit.Err != nil {
+				fmt.Fprintln(os.Stderr, "Error:", exit.Err)
+			}
+			return exit.Code
+		}
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return ExitFailed
+	}
+	return ExitPassed
+}
+
+// clientFlags are the connection flags shared by client commands, defaulting
+// to the SUPABENCH_URI and SUPABENCH_TOKEN loaders use.
+type clientFlags struct {
+	url   string
+	token string
+}
+
+func (f *clientFlags) register(cmd *cobra.Command) {
+	uri := viper.GetString("URI")
+	if uri == "" {
+		uri = "http://localhost:8090"
+	}
+	cmd.PersistentFlags().StringVar(&f.url, "url", uri, "supabench server URL")
+	cmd.PersistentFlags().StringVar(&f.token, "token", viper.GetString("TOKEN"), "admin or privileged user token")
+}
+
+func (f *clientFlags) client() *Client {
+	return NewClient(f.url, f.token)
+}
+
+// waitFlags control how long commands follow a run.
+type waitFlags struct {
+	timeout      time.Duration
+	interval     time.Duration
+	skipTeardown bool
+}
+
+func (f *waitFlags) register(cmd *cobra.Command) {
+	cmd.Flags().DurationVar(&f.timeout, "timeout", 3*time.Hour, "how long to wait for the run, 0 waits forever")
+	cmd.Flags().DurationVar(&f.interval, "interval", 10*time.Second, "how often to poll the run")
+	cmd.Flags().BoolVar(&f.skipTeardown, "skip-teardown", false, "stop once the result is known instead of waiting for teardown")
+}
+
+func runCommand() *cobra.Command {
+	flags := &clientFlags{}
+	cmd := &cobra.Command{
+		Use:   "run",
+		Short: "Create and follow benchmark runs",
+	}
+	flags.register(cmd)
+	cmd.AddCommand(
+		runCreateCommand(flags),
+		runWatchCommand(flags),
+		runLogsCommand(flags),
+		runCancelCommand(flags),
+		runPinCommand(flags, true),
+		runPinCommand(flags, false),
+	)
+	return cmd
+}
+
+func runCreateCommand(flags *clientFlags) *cobra.Command {
+	var (
+		newRun         NewRun
+		origin         string
+		comment        string
+		vars           []string
+		idempotencyKey string
+		wait           bool
+		w              waitFlags
+	)
+	cmd := &cobra.Command{
+		Use:   "create",
+		Short: "Queue a run of a benchmark",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if newRun.BenchmarkID == "" || newRun.Name == "" {
+				return errors.New("--benchmark and --name are required")
+			}
+			if origin != "" {
+				newRun.Origin = &origin
+			}
+			if comment != "" {
+				newRun.Comment = &comment
+			}
+			if len(vars) > 0 {
+				v, err := parseVars(vars)
+				if err != nil {
+					return err
+				}
+				newRun.Vars = &v
+			}
+
+			c := flags.client()
+			run, err := c.CreateRun(cmd.Context(), newRun, idempotencyKey)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "created run %s (%s)\n", run.ID, run.Name)
+			if !wait {
+				return nil
+			}
+			return watch(cmd.Context(), c, run.ID, w, cmd.OutOrStdout())
+		},
+	}
+	cmd.Flags().StringVar(&newRun.BenchmarkID, "benchmark", "", "benchmark ID")
+	cmd.Flags().StringVar(&newRun.Name, "name", "", "run name")
+	cmd.Flags().StringVar(&origin, "origin", "", "run origin, e.g. a branch or version")
+	cmd.Flags().StringVar(&comment, "comment", "", "run comment")
+	cmd.Flags().StringArrayVar(&vars, "var", nil, "run variable as key=value, repeatable")
+	cmd.Flags().IntVar(&newRun.Priority, "priority", 0, "queue priority")
+	cmd.Flags().StringVar(&newRun.PRLink, "pr-link", "", "pull request to comment the results on")
+	cmd.Flags().BoolVar(&newRun.Supersede, "supersede", false, "cancel pending runs of the benchmark for the same pull request")
+	cmd.Flags().BoolVar(&newRun.DryRun, "dry-run", false, "only plan the run")
+	cmd.Flags().StringVar(&idempotencyKey, "idempotency-key", "", "key to safely retry the request")
+	cmd.Flags().BoolVar(&wait, "wait", false, "wait for the run and exit with its result")
+	w.register(cmd)
+	return cmd
+}
+
+func runWatchCommand(flags *clientFlags) *cobra.Command {
+	var w waitFlags
+	cmd := &cobra.Command{
+		Use:   "watch <run-id>",
+		Short: "Wait for a run and exit with its result",
+		Long: `Wait for a run, print its metrics and exit with its result: 0 if it passed,
+1 if it failed, 2 if a k6 threshold failed and 3 if waiting timed out.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return watch(cmd.Context(), flags.client(), args[0], w, cmd.OutOrStdout())
+		},
+	}
+	w.register(cmd)
+	return cmd
+}
+
+func runLogsCommand(flags *clientFlags) *cobra.Command {
+	return &cobra.Command{
+		Use:   "logs <run-id>",
+		Short: "Print the history, phases, errors and output of a run",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c := flags.client()
+			run, err := c.Run(cmd.Context(), args[0])
+			if err != nil {
+				return err
+			}
+			events, err := c.RunEvents(cmd.Context(), args[0])
+			if err != nil {
+				return err
+			}
+
+			out := cmd.OutOrStdout()
+			fmt.Fprintf(out, "run %s (%s): %s\n\n", run.ID, run.Name, run.Status)
+			for _, e := range events {
+				printEvent(out, e)
+			}
+			if len(run.Phases) > 0 {
+				fmt.Fprintln(out)
+				printPhases(out, run.Phases)
+			}
+			if errs := string(run.Errors); errs != "" && errs != "null" {
+				fmt.Fprintln(out, "\nerrors:")
+				fmt.Fprintln(out, indentJSON(run.Errors))
+			}
+			if run.Output != "" {
+				fmt.Fprintln(out, "\noutput:")
+				fmt.Fprintln(out, run.Output)
+			}
+			if run.Plan != "" {
+				fmt.Fprintln(out, "\nplan:")
+				fmt.Fprintln(out, run.Plan)
+			}
+			return nil
+		},
+	}
+}
+
+func runCancelCommand(flags *clientFlags) *cobra.Command {
+	return &cobra.Command{
+		Use:   "cancel <run-id>",
+		Short: "Cancel a queued or executing run",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			run, err := flags.client().CancelRun(cmd.Context(), args[0])
+			if err != nil {
+				return err
+			}
+			if run.Status == "cancelled" {
+				fmt.Fprintf(cmd.OutOrStdout(), "cancelled run %s\n", run.ID)
+				return nil
+			}
+			// executing runs are interrupted and torn down in the background
+			fmt.Fprintf(cmd.OutOrStdout(), "cancelling run %s, follow it with run watch\n", run.ID)
+			return nil
+		},
+	}
+}
+
+func runPinCommand(flags *clientFlags, pinned bool) *cobra.Command {
+	use, short := "pin", "Keep a run, e.g. a baseline, from retention"
+	if !pinned {
+		use, short = "unpin", "Let retention compact and delete a run again"
+	}
+	return &cobra.Command{
+		Use:   use + " <run-id>",
+		Short: short,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if _, err := flags.client().PinRun(cmd.Context(), args[0], pinned); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "%sned run %s\n", use, args[0])
+			return nil
+		},
+	}
+}
+
+func benchmarkCommand() *cobra.Command {
+	flags := &clientFlags{}
+	cmd := &cobra.Command{
+		Use:   "benchmark",
+		Short: "Inspect benchmarks",
+	}
+	flags.register(cmd)
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "List benchmarks",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			benchmarks, err := flags.client().Benchmarks(cmd.Context())
+			if err != nil {
+				return err
+			}
+			tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "ID\tNAME\tSLUG\tPROJECT")
+			for _, b := range benchmarks {
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", b.ID, b.Name, b.Slug, b.ProjectID)
+			}
+			return tw.Flush()
+		},
+	})
+	return cmd
+}
+
+func compareCommand() *cobra.Command {
+	var (
+		flags         clientFlags
+		metric        string
+		threshold     float64
+		lowerIsBetter bool
+	)
+	cmd := &cobra.Command{
+		Use:   "compare <base-run-id> <run-id>",
+		Short: "Compare the metrics of two runs",
+		Long: `Compare the metrics of a run against a base run. Exits with 2 if a key
+metric regressed by more than its threshold. The key metrics default to the
+thresholds in the benchmark meta, or else its extract_metric_path.`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c := flags.client()
+			base, err := c.Run(cmd.Context(), args[0])
+			if err != nil {
+				return err
+			}
+			run, err := c.Run(cmd.Context(), args[1])
+			if err != nil {
+				return err
+			}
+
+			out := cmd.OutOrStdout()
+			printComparison(out, summary.Values(base.Raw), summary.Values(run.Raw))
+
+			thresholds := []models.Threshold{}
+			if metric != "" {
+				thresholds = append(thresholds, models.Threshold{Metric: metric, MaxRegression: threshold, LowerIsBetter: lowerIsBetter})
+			} else {
+				b, err := c.Benchmark(cmd.Context(), run.BenchmarkID)
+				if err != nil {
+					return err
+				}
+				thresholds = benchmarkThresholds(b)
+				if len(thresholds) == 0 && b.ExtractMetricPath != "" {
+					thresholds = append(thresholds, models.Threshold{Metric: b.ExtractMetricPath, MaxRegression: threshold, LowerIsBetter: lowerIsBetter})
+				}
+			}
+			if len(thresholds) == 0 {
+				fmt.Fprintln(out, "\nno key metric to check, set --metric")
+				return nil
+			}
+
+			fmt.Fprintln(out)
+			regressed := []string{}
+			for _, t := range thresholds {
+				before, err := keyMetric(base.Raw, t.Metric)
+				if err != nil {
+					return fmt.Errorf("base run: %w", err)
+				}
+				after, err := keyMetric(run.Raw, t.Metric)
+				if err != nil {
+					return err
+				}
+				change := percentChange(before, after)
+				fmt.Fprintf(out, "%s: %s -> %s (%+.2f%%)\n", t.Metric, formatValue(before), formatValue(after), change)
+
+				if t.LowerIsBetter {
+					change = -change
+				}
+				if change < -t.MaxRegression {
+					regressed = append(regressed, fmt.Sprintf("%s regressed by more than %g%%", t.Metric, t.MaxRegression))
+				}
+			}
+			if len(regressed) > 0 {
+				return &ExitError{Code: ExitRegressed, Err: errors.New(strings.Join(regressed, "; "))}
+			}
+			return nil
+		},
+	}
+	flags.register(cmd)
+	cmd.Flags().StringVar(&metric, "metric", "", "key metric, a JSONPath into the raw data or a name like http_req_duration.p(95)")
+	cmd.Flags().Float64Var(&threshold, "threshold", 5, "allowed regression of the key metric in percent")
+	cmd.Flags().BoolVar(&lowerIsBetter, "lower-is-better", false, "treat an increase of the key metric as a regression, e.g. for latencies")
+	return cmd
+}
+
+// maxWatchBackoff caps the delay between retries of failed requests.
+const maxWatchBackoff = time.Minute
+
+// watch follows the run until it is done and returns an ExitError unless it
+// passed. Network and server errors are retried with backoff.
+func watch(ctx context.Context, c *Client, id string, w waitFlags, out io.Writer) error {
+	if w.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, w.timeout)
+		defer cancel()
+	}
+
+	seen := 0
+	delay := w.interval
+	for {
+		events, err := c.RunEvents(ctx, id)
+		if err == nil {
+			for _, e := range events[min(seen, len(events)):] {
+				printEvent(out, e)
+			}
+			seen = len(events)
+
+			var run *Run
+			run, err = c.Run(ctx, id)
+			if err == nil && runDone(run, events, w.skipTeardown) {
+				return report(out, run, events)
+			}
+		}
+		if ctx.Err() != nil {
+			return &ExitError{Code: ExitTimeout, Err: fmt.Errorf("run %s did not finish in %s", id, w.timeout)}
+		}
+		if err != nil && !temporary(err) {
+			return err
+		}
+
+		wait := w.interval
+		if err != nil {
+			fmt.Fprintf(out, "error following run, retrying in %s: %v\n", delay, err)
+			wait = delay
+			delay = min(2*delay, maxWatchBackoff)
+		} else {
+			delay = w.interval
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(wait):
+		}
+	}
+}
+
+// runResult returns the status a run finished executing with, before it
+// was torn down.
+func runResult(run *Run, events []RunEvent) string {
+	result := ""
+	for _, e := range events {
+		if e.ToStatus == "tearing_down" {
+			break
+		}
+		switch e.ToStatus {
+		case "success", "fail", "timeout", "cancelled", "finished":
+			result = e.ToStatus
+		}
+	}
+	if result == "" {
+		result = run.Status
+	}
+	return result
+}
+
+func runDone(run *Run, events []RunEvent, skipTeardown bool) bool {
+	switch run.Status {
+	case "finished":
+		return true
+	case "cancelled":
+		return run.FinishedAt != "" || skipTeardown
+	case "success", "timeout":
+		return skipTeardown
+	case "fail":
+		// a failed teardown leaves the run to the reaper
+		if n := len(events); n > 0 && events[n-1].FromStatus == "tearing_down" {
+			return true
+		}
+		return skipTeardown
+	}
+	return false
+}
+
+// report prints the result of a finished run and returns its exit error.
+func report(out io.Writer, run *Run, events []RunEvent) error {
+	result := runResult(run, events)
+	fmt.Fprintf(out, "\nrun %s (%s): %s\n", run.ID, run.Name, result)
+	if run.Status == "fail" && result != "fail" {
+		fmt.Fprintln(out, "teardown failed, resources are left to the reaper")
+	}
+	if len(run.Phases) > 0 {
+		fmt.Fprintln(out)
+		printPhases(out, run.Phases)
+	}
+	if len(run.Raw) > 0 && string(run.Raw) != "null" {
+		fmt.Fprintln(out)
+		printMetrics(out, run.Raw)
+	}
+	if len(run.Outputs) > 0 {
+		fmt.Fprintln(out)
+		printOutputs(out, run.Outputs)
+	}
+
+	switch result {
+	case "success", "finished":
+	default:
+		return &ExitError{Code: ExitFailed, Err: fmt.Errorf("run %s %s", run.ID, result)}
+	}
+	if failed := summary.FailedThresholds(run.Raw); len(failed) > 0 {
+		fmt.Fprintln(out, "\nfailed thresholds:")
+		for _, t := range failed {
+			fmt.Fprintln(out, "  "+t)
+		}
+		return &ExitError{Code: ExitRegressed, Err: fmt.Errorf("run %s did not meet its thresholds", run.ID)}
+	}
+	return nil
+}
+
+func printEvent(out io.Writer, e RunEvent) {
+	from := e.FromStatus
+	if from == "" {
+		from = "created"
+	}
+	line := fmt.Sprintf("%s  %s -> %s (%s)", e.Created, from, e.ToStatus, e.Source)
+	if e.Reason != "" {
+		line += ": " + e.Reason
+	}
+	fmt.Fprintln(out, line)
+}
+
+func printPhases(out io.Writer, phases []Phase) {
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PHASE\tDURATION\tERROR")
+	for _, p := range phases {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", p.Name, phaseDuration(p), p.Error)
+	}
+	tw.Flush()
+}
+
+func phaseDuration(p Phase) string {
+	const layout = "2006-01-02 15:04:05.000Z"
+	started, err := time.Parse(layout, p.StartedAt)
+	if err != nil {
+		return "-"
+	}
+	ended, err := time.Parse(layout, p.EndedAt)
+	if err != nil {
+		return "-"
+	}
+	return ended.Sub(started).Round(time.Second).String()
+}
+
+func printOutputs(out io.Writer, outputs map[string]string) {
+	names := make([]string, 0, len(outputs))
+	for name := range outputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "OUTPUT\tVALUE")
+	for _, name := range names {
+		fmt.Fprintf(tw, "%s\t%s\n", name, outputs[name])
+	}
+	tw.Flush()
+}
+
+func printComparison(out io.Writer, base, run map[string]float64) {
+	names := []string{}
+	for name := range run {
+		if _, ok := base[name]; ok {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		fmt.Fprintln(out, "no common metrics")
+		return
+	}
+	sort.Strings(names)
+
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "METRIC\tBASE\tRUN\tCHANGE")
+	for _, name := range names {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%+.2f%%\n", name, formatValue(base[name]), formatValue(run[name]), percentChange(base[name], run[name]))
+	}
+	tw.Flush()
+}
+
+// keyMetric looks up a metric by JSONPath or by its flattened name.
+func keyMetric(raw []byte, metric string) (float64, error) {
+	if strings.HasPrefix(metric, "$") {
+		return summary.Lookup(raw, metric)
+	}
+	v, ok := summary.Values(raw)[metric]
+	if !ok {
+		return 0, fmt.Errorf("metric %s not found", metric)
+	}
+	return v, nil
+}
+
+// benchmarkThresholds returns the thresholds stored in the benchmark meta,
+// e.g. by apply.
+func benchmarkThresholds(b *Benchmark) []models.Threshold {
+	var meta struct {
+		Thresholds []models.Threshold `json:"thresholds"`
+	}
+	if len(b.Meta) > 0 {
+		_ = json.Unmarshal(b.Meta, &meta)
+	}
+	return meta.Thresholds
+}
+
+func percentChange(before, after float64) float64 {
+	if before == 0 {
+		return 0
+	}
+	return (after - before) / before * 100
+}
+
+func parseVars(kvs []string) (string, error) {
+	vars := map[string]string{}
+	for _, kv := range kvs {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok || k == "" {
+			return "", fmt.Errorf("invalid var %q, expected key=value", kv)
+		}
+		vars[k] = v
+	}
+	b, err := json.Marshal(vars)
+	return string(b), err
+}
+
+func indentJSON(b []byte) string {
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return string(b)
+	}
+	out, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return string(b)
+	}
+	return string(out)
+}
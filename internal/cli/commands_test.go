@@ -0,0 +1,124 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+)
+
+func events(transitions ...string) []RunEvent {
+	var evs []RunEvent
+	for i := 1; i < len(transitions); i++ {
+		evs = append(evs, RunEvent{FromStatus: transitions[i-1], ToStatus: transitions[i]})
+	}
+	return evs
+}
+
+func TestRunResult(t *testing.T) {
+	tests := []struct {
+		name   string
+		status string
+		events []RunEvent
+		want   string
+	}{
+		{name: "torn down", status: "finished", events: events("pending", "provisioning", "running", "success", "tearing_down", "finished"), want: "success"},
+		{name: "failed teardown", status: "fail", events: events("pending", "provisioning", "running", "success", "tearing_down", "fail"), want: "success"},
+		{name: "timed out", status: "finished", events: events("pending", "provisioning", "running", "timeout", "tearing_down", "finished"), want: "timeout"},
+		{name: "cancelled while executing", status: "finished", events: events("pending", "provisioning", "running", "cancelled", "tearing_down", "finished"), want: "cancelled"},
+		{name: "not torn down yet", status: "fail", events: events("pending", "provisioning", "fail"), want: "fail"},
+		{name: "no events", status: "running", events: nil, want: "running"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := runResult(&Run{Status: tt.status}, tt.events); got != tt.want {
+				t.Errorf("runResult() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunDone(t *testing.T) {
+	tests := []struct {
+		name         string
+		run          Run
+		events       []RunEvent
+		skipTeardown bool
+		want         bool
+	}{
+		{name: "pending", run: Run{Status: "pending"}, want: false},
+		{name: "running", run: Run{Status: "running"}, want: false},
+		{name: "finished", run: Run{Status: "finished"}, want: true},
+		{name: "success waits for teardown", run: Run{Status: "success"}, want: false},
+		{name: "success without teardown", run: Run{Status: "success"}, skipTeardown: true, want: true},
+		{name: "dropped from the queue", run: Run{Status: "cancelled", FinishedAt: "2026-10-19 10:00:00.000Z"}, want: true},
+		{name: "cancelled while executing", run: Run{Status: "cancelled"}, want: false},
+		{name: "failed run waits for teardown", run: Run{Status: "fail"}, events: events("provisioning", "fail"), want: false},
+		{name: "failed teardown", run: Run{Status: "fail"}, events: events("success", "tearing_down", "fail"), want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := runDone(&tt.run, tt.events, tt.skipTeardown); got != tt.want {
+				t.Errorf("runDone() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReport(t *testing.T) {
+	passed := json.RawMessage(`{"metrics":{"http_reqs":{"values":{"count":10},"thresholds":{"count>5":{"ok":true}}}}}`)
+	regressed := json.RawMessage(`{"metrics":{"http_reqs":{"values":{"count":1},"thresholds":{"count>5":{"ok":false}}}}}`)
+
+	tests := []struct {
+		name     string
+		run      Run
+		events   []RunEvent
+		wantCode int
+	}{
+		{name: "passed", run: Run{Status: "finished", Raw: passed}, events: events("running", "success", "tearing_down", "finished"), wantCode: ExitPassed},
+		{name: "failed thresholds", run: Run{Status: "finished", Raw: regressed}, events: events("running", "success", "tearing_down", "finished"), wantCode: ExitRegressed},
+		{name: "failed", run: Run{Status: "finished"}, events: events("running", "fail", "tearing_down", "finished"), wantCode: ExitFailed},
+		{name: "timed out", run: Run{Status: "finished"}, events: events("running", "timeout", "tearing_down", "finished"), wantCode: ExitFailed},
+		{name: "cancelled", run: Run{Status: "finished"}, events: events("running", "cancelled", "tearing_down", "finished"), wantCode: ExitFailed},
+		{name: "failed teardown", run: Run{Status: "fail", Raw: passed}, events: events("running", "success", "tearing_down", "fail"), wantCode: ExitPassed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := report(io.Discard, &tt.run, tt.events)
+			if tt.wantCode == ExitPassed {
+				if err != nil {
+					t.Fatalf("report() error = %v, want nil", err)
+				}
+				return
+			}
+			var exitErr *ExitError
+			if !errors.As(err, &exitErr) || exitErr.Code != tt.wantCode {
+				t.Fatalf("report() error = %v, want exit code %d", err, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestPercentChange(t *testing.T) {
+	tests := []struct {
+		name          string
+		before, after float64
+		want          float64
+	}{
+		{name: "increase", before: 100, after: 110, want: 10},
+		{name: "decrease", before: 200, after: 150, want: -25},
+		{name: "unchanged", before: 42, after: 42, want: 0},
+		{name: "no baseline", before: 0, after: 10, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := percentChange(tt.before, tt.after); got != tt.want {
+				t.Errorf("percentChange(%v, %v) = %v, want %v", tt.before, tt.after, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package execution
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+// alert logs the message and posts it to SUPABENCH_ALERT_WEBHOOK_URL, if
+// set, as a Slack compatible {"text": ...} payload.
+func (app *App) alert(msg string) {
+	log.Error().Msg(msg)
+
+	url := viper.GetString("ALERT_WEBHOOK_URL")
+	if url == "" {
+		return
+	}
+	b, err := json.Marshal(map[string]string{"text": msg})
+	if err != nil {
+		return
+	}
+	client := http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(b))
+	if err != nil {
+		log.Error().Err(err).Msg("error sending alert")
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Error().Int("status", resp.StatusCode).Msg("error sending alert")
+	}
+}
@@ -1,6 +1,9 @@
 package execution
 
 import (
+	"context"
+	"sync"
+
 	"github.com/go-co-op/gocron"
 	"github.com/pocketbase/pocketbase"
 	"github.com/supabase/supabench/internal/gh"
@@ -8,12 +11,21 @@ import (
 )
 
 type App struct {
-	TF          *terraform.TfExec
-	PB          *pocketbase.PocketBase
-	GH          *gh.Client
-	cron        *gocron.Scheduler
-	runJob      *gocron.Job
-	teardownJob *gocron.Job
+	TF           *terraform.TfExec
+	PB           *pocketbase.PocketBase
+	GH           *gh.Client
+	cron         *gocron.Scheduler
+	runJob       *gocron.Job
+	teardownJob  *gocron.Job
+	reaperJob    *gocron.Job
+	resourceJob  *gocron.Job
+	retentionJob *gocron.Job
+	pushJob      *gocron.Job
+
+	// the run the scheduler executes and how to interrupt it
+	execMu     sync.Mutex
+	execRunID  string
+	execCancel context.CancelCauseFunc
 }
 
 func New(pb *pocketbase.PocketBase, tf *terraform.TfExec, gh *gh.Client) *App {
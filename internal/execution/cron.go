@@ -8,7 +8,9 @@ import (
 
 	"github.com/go-co-op/gocron"
 	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/tools/types"
 	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
 	"github.com/supabase/supabench/internal/gh"
 	"github.com/supabase/supabench/models"
 )
@@ -25,12 +27,32 @@ func (app *App) NewCron() error {
 	if err != nil {
 		return err
 	}
+	reaperJob, err := s.Every("1m").Do(app.reapEnvironments)
+	if err != nil {
+		return err
+	}
+	resourceJob, err := s.Every("1m").Do(app.reapResources)
+	if err != nil {
+		return err
+	}
+	retentionJob, err := s.Every("10m").Do(app.applyRetention)
+	if err != nil {
+		return err
+	}
+	pushJob, err := s.Every("5m").Do(app.retrySummaryPushes)
+	if err != nil {
+		return err
+	}
 
 	s.StartAsync()
 
 	app.cron = s
 	app.runJob = runJob
 	app.teardownJob = teardownJob
+	app.reaperJob = reaperJob
+	app.resourceJob = resourceJob
+	app.retentionJob = retentionJob
+	app.pushJob = pushJob
 
 	return nil
 }
@@ -40,13 +62,13 @@ func (app *App) runBenchmarks() {
 		return
 	}
 
-	running, err := app.checkExistByStatus("running", "success", "fail")
+	running, err := app.executorBusy()
 	if err != nil {
 		log.Error().Err(err).Msg("error checking if there is a running benchmark")
 		return
 	}
 
-	runs, err := app.findRunsByStatus("pending")
+	runs, err := app.findRunsByStatus(StatusPending)
 	if err != nil {
 		log.Error().Err(err).Msg("error finding pending runs")
 		return
@@ -70,16 +92,36 @@ func (app *App) runBenchmarks() {
 		Str("name", run.Name).
 		Msg("running benchmark")
 
-	run.Status = "running"
-	if err := app.PB.DB().Model(&run).Update("Status"); err != nil {
+	run.ExecutedAt = types.NowDateTime()
+	if err := app.Transition(&run, StatusProvisioning, SourceScheduler, "", "ExecutedAt"); err != nil {
 		log.Error().Err(err).Msg("error updating run status")
 		return
 	}
 
-	if err := app.runBenchmark(&run); err != nil {
+	ctx, cancel := runContext()
+	defer cancel()
+	ctx, interrupt := context.WithCancelCause(ctx)
+	defer interrupt(nil)
+	app.setExecuting(run.Id, interrupt)
+	defer app.setExecuting("", nil)
+
+	if err := app.runBenchmark(ctx, &run); err != nil {
+		if context.Cause(ctx) == errRunCancelled {
+			// torn down like every other cancelled run that was picked up
+			log.Info().Str("run_id", run.Id).Msg("benchmark cancelled")
+			if err := app.Transition(&run, StatusCancelled, SourceAPI, "cancelled while executing"); err != nil {
+				log.Error().Err(err).Msg("error updating run status to cancelled")
+			}
+			return
+		}
+
 		log.Error().Err(err).Msg("error running benchmark")
-		run.Status = "fail"
-		if err := app.PB.DB().Model(&run).Update("Status"); err != nil {
+		app.recordError(&run, err)
+		status := StatusFail
+		if ctx.Err() == context.DeadlineExceeded {
+			status = StatusTimeout
+		}
+		if err := app.Transition(&run, status, SourceScheduler, err.Error()); err != nil {
 			log.Error().Err(err).Msg("error updating run status to failed")
 		}
 
@@ -89,18 +131,22 @@ func (app *App) runBenchmarks() {
 		}
 
 		if run.Output == nil || *run.Output == "" {
-			app.GH.AddOrUpdateComment(context.TODO(), prLink, gh.SmthWentWrongCommentString())
+			app.comment(run, prLink, withTimings(gh.SmthWentWrongCommentString(), run))
 		} else {
 			started, ended := setStartedEnded(run)
 			gurl := *benchmarkRecord.GrafanaURL + "&from=" + started + "&to=" + ended + "&var-testrun=" + run.Name
-			app.GH.AddOrUpdateComment(context.TODO(), prLink, gh.FailureCommentString(gurl, *run.Output))
+			app.comment(run, prLink, withTimings(gh.FailureCommentString(gurl, *run.Output), run))
 		}
 
 		return
 	}
 
-	run.Status = "success"
-	if err := app.PB.DB().Model(&run).Update("Status"); err != nil {
+	if run.DryRun {
+		app.finishDryRun(&run)
+		return
+	}
+
+	if err := app.Transition(&run, StatusSuccess, SourceScheduler, ""); err != nil {
 		log.Error().Err(err).Msg("error updating run status to success")
 		return
 	}
@@ -116,7 +162,7 @@ func (app *App) runBenchmarks() {
 	}
 	started, ended := setStartedEnded(run)
 	gurl := *benchmarkRecord.GrafanaURL + "&from=" + started + "&to=" + ended + "&var-testrun=" + run.Name
-	app.GH.AddOrUpdateComment(context.TODO(), prLink, gh.SuccessCommentString(gurl, *run.Output))
+	app.comment(run, prLink, withTimings(gh.SuccessCommentString(gurl, *run.Output), run))
 }
 
 func (app *App) teardownBenchmarks() {
@@ -124,18 +170,12 @@ func (app *App) teardownBenchmarks() {
 		return
 	}
 
-	running, err := app.checkExistByStatus("success", "fail")
+	runs, err := app.findRunsToTeardown()
 	if err != nil {
-		log.Error().Err(err).Msg("error checking if there is a benchmark that needs to be cleaned up")
-		return
-	}
-	if !running {
+		log.Error().Err(err).Msg("error finding runs that need to be cleaned up")
 		return
 	}
-
-	runs, err := app.findRunsByStatus("success", "fail")
-	if err != nil {
-		log.Error().Err(err).Msg("error finding runs that need to be cleaned up")
+	if len(runs) == 0 {
 		return
 	}
 
@@ -151,10 +191,16 @@ func (app *App) teardownBenchmarks() {
 			Str("name", run.Name).
 			Msg("teardown benchmark")
 
+		succeeded := run.Status == StatusSuccess
+		if err := app.Transition(&run, StatusTearingDown, SourceScheduler, ""); err != nil {
+			log.Error().Err(err).Msg("error updating run status to tearing down")
+			return
+		}
+
 		if err := app.teardownBenchmark(&run); err != nil {
 			log.Error().Err(err).Msg("error when teardown benchmark")
-			run.Status = "fail"
-			if err := app.PB.DB().Model(&run).Update("Status"); err != nil {
+			app.recordError(&run, err)
+			if err := app.Transition(&run, StatusFail, SourceScheduler, err.Error()); err != nil {
 				log.Error().Err(err).Msg("error updating run status to failed")
 			}
 
@@ -162,11 +208,11 @@ func (app *App) teardownBenchmarks() {
 			if !ok {
 				return
 			}
-			app.GH.AddOrUpdateComment(context.TODO(), prLink, gh.SmthWentWrongCommentString())
+			app.comment(run, prLink, withTimings(gh.SmthWentWrongCommentString(), run))
 			return
 		}
 
-		if run.Status == "success" && run.StartedAt != nil && run.EndedAt != nil {
+		if succeeded && run.StartedAt != nil && run.EndedAt != nil {
 			started, ended := setStartedEnded(run)
 			run.StartedAt = &started
 			run.EndedAt = &ended
@@ -178,25 +224,33 @@ func (app *App) teardownBenchmarks() {
 					run.Output = &output
 				}
 				gurl := *benchmarkRecord.GrafanaURL + "&from=" + started + "&to=" + ended + "&var-testrun=" + run.Name
-				app.GH.AddOrUpdateComment(context.TODO(), prLink, gh.SuccessCommentString(gurl, *run.Output))
+				app.comment(run, prLink, withTimings(gh.SuccessCommentString(gurl, *run.Output), run))
 			}
 		}
 
-		run.Status = "finished"
-		if err := app.PB.DB().Model(&run).Update("Status", "EndedAt", "StartedAt"); err != nil {
+		run.FinishedAt = types.NowDateTime()
+		if err := app.Transition(&run, StatusFinished, SourceScheduler, "", "EndedAt", "StartedAt", "FinishedAt"); err != nil {
 			log.Error().Err(err).Msg("error updating run status to finished")
 			return
 		}
 	}
 }
 
-// looks for pending runs in app.DB and returns it
-func (app *App) findRunsByStatus(status ...interface{}) ([]models.Run, error) {
+// findRunsToTeardown returns runs whose resources have to be destroyed:
+// runs that are done executing and cancelled runs that were picked up.
+func (app *App) findRunsToTeardown() ([]models.Run, error) {
 	var runs []models.Run
 	if err := app.PB.DB().
 		Select().
-		Where(dbx.In("status", status...)).
-		OrderBy("triggered_at").
+		Where(dbx.Or(
+			dbx.In("status", StatusSuccess, StatusFail, StatusTimeout, StatusTearingDown),
+			dbx.And(
+				dbx.HashExp{"status": StatusCancelled},
+				dbx.NewExp("executed_at != '' AND finished_at = ''"),
+			),
+		)).
+		AndWhere(leakedRuns).
+		OrderBy("priority DESC", "triggered_at").
 		All(&runs); err != nil {
 		return nil, err
 	}
@@ -204,11 +258,14 @@ func (app *App) findRunsByStatus(status ...interface{}) ([]models.Run, error) {
 	return runs, nil
 }
 
-func (app *App) checkExistByStatus(status ...interface{}) (bool, error) {
+// executorBusy reports whether a run holds the executor. Runs whose
+// resources leaked are left to the reaper and do not block the queue.
+func (app *App) executorBusy() (bool, error) {
 	var runs []models.Run
 	if err := app.PB.DB().
 		Select().
-		Where(dbx.In("status", status...)).
+		Where(dbx.In("status", activeStatuses...)).
+		AndWhere(leakedRuns).
 		All(&runs); err != nil {
 		return false, err
 	}
@@ -216,6 +273,29 @@ func (app *App) checkExistByStatus(status ...interface{}) (bool, error) {
 	return len(runs) > 0, nil
 }
 
+// runContext limits how long a run may execute, configured with
+// SUPABENCH_RUN_TIMEOUT. Runs are not limited by default.
+func runContext() (context.Context, context.CancelFunc) {
+	if d := viper.GetDuration("RUN_TIMEOUT"); d > 0 {
+		return context.WithTimeout(context.Background(), d)
+	}
+	return context.WithCancel(context.Background())
+}
+
+// looks for runs with given statuses in app.DB and returns them in queue order
+func (app *App) findRunsByStatus(status ...interface{}) ([]models.Run, error) {
+	var runs []models.Run
+	if err := app.PB.DB().
+		Select().
+		Where(dbx.In("status", status...)).
+		OrderBy("priority DESC", "triggered_at").
+		All(&runs); err != nil {
+		return nil, err
+	}
+
+	return runs, nil
+}
+
 func setStartedEnded(run models.Run) (startedAt, endedAt string) {
 	started, errStarted := strconv.Atoi(*run.StartedAt)
 	ended, errEnded := strconv.Atoi(*run.EndedAt)
@@ -0,0 +1,136 @@
+package execution
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/pocketbase/pocketbase/tools/types"
+	"github.com/rs/zerolog/log"
+	"github.com/supabase/supabench/internal/gh"
+	"github.com/supabase/supabench/internal/redact"
+	"github.com/supabase/supabench/internal/terraform"
+	"github.com/supabase/supabench/models"
+)
+
+// planRun plans the unpacked script instead of applying it and stores the
+// plan on the run. For split scripts the load module can only be planned
+// against an environment that is already up, so the JSON plan holds the
+// plan of each module by name.
+func (app *App) planRun(ctx context.Context, run *models.Run, scriptWD, versionID string,
+	envs, vars map[string]string, opts terraform.ExecOptions, r *redact.Redactor) error {
+	if !isSplit(scriptWD) {
+		if err := app.phase(run, PhaseInit, func() error {
+			return r.Error(app.TF.Init(ctx, scriptWD, opts))
+		}); err != nil {
+			return err
+		}
+
+		var out string
+		var plan *tfjson.Plan
+		if err := app.phase(run, PhasePlan, func() error {
+			var err error
+			out, plan, err = app.TF.Plan(ctx, scriptWD, envs, vars, opts, r)
+			return r.Error(err)
+		}); err != nil {
+			return err
+		}
+		log.Info().Str("run_id", run.Id).Msg(terraform.PlanSummary(plan))
+		return app.savePlan(run, out, plan, r)
+	}
+
+	if len(opts.Targets) > 0 {
+		return ErrSplitTargets
+	}
+	envVars := environmentVars(vars)
+	key, err := environmentKey(versionID, envVars)
+	if err != nil {
+		return err
+	}
+	env, err := app.findEnvironment(run.BenchmarkID)
+	if err != nil {
+		return err
+	}
+	if env != nil && env.Key != key {
+		env = nil
+	}
+
+	envWD := path.Join(scriptWD, environmentModule)
+	loadWD := path.Join(scriptWD, loadModule)
+	if err := app.phase(run, PhaseInit, func() error {
+		if env == nil {
+			return r.Error(app.TF.Init(ctx, envWD, opts))
+		}
+		return r.Error(app.TF.Init(ctx, loadWD, opts))
+	}); err != nil {
+		return err
+	}
+
+	var out string
+	plans := map[string]*tfjson.Plan{}
+	if err := app.phase(run, PhasePlan, func() error {
+		if env == nil {
+			envOut, plan, err := app.TF.Plan(ctx, envWD, envs, terraform.DeclaredOnly(envWD, envVars), opts, r)
+			if err != nil {
+				return r.Error(err)
+			}
+			plans[environmentModule] = plan
+			out = "# environment\n\n" + envOut +
+				"\n# load\n\nThe load module is planned once the environment is up.\n"
+			return nil
+		}
+
+		loadVars, err := app.loadVars(ctx, environmentWD(env.Id), loadWD, vars, r)
+		if err != nil {
+			return err
+		}
+		loadOut, plan, err := app.TF.Plan(ctx, loadWD, envs, loadVars, opts, r)
+		if err != nil {
+			return r.Error(err)
+		}
+		plans[loadModule] = plan
+		out = "# environment\n\nReusing environment " + env.Id + ".\n\n# load\n\n" + loadOut
+		return nil
+	}); err != nil {
+		return err
+	}
+	return app.savePlan(run, out, plans, r)
+}
+
+func (app *App) savePlan(run *models.Run, out string, plan interface{}, r *redact.Redactor) error {
+	b, err := json.Marshal(plan)
+	if err != nil {
+		return err
+	}
+	planOut := r.String(out)
+	planJSON := string(r.JSON(b))
+	run.Plan = &planOut
+	run.PlanJSON = &planJSON
+	return app.PB.DB().Model(run).Update("Plan", "PlanJSON")
+}
+
+// finishDryRun removes the working dir of a planned run and finishes it,
+// there is nothing to tear down.
+func (app *App) finishDryRun(run *models.Run) {
+	if err := os.RemoveAll(runDir(run.Id)); err != nil {
+		log.Warn().Err(err).Msg("cannot remove run working dir")
+	}
+
+	run.FinishedAt = types.NowDateTime()
+	if err := app.Transition(run, StatusFinished, SourceScheduler, "dry run", "FinishedAt"); err != nil {
+		log.Error().Err(err).Msg("error updating run status to finished")
+		return
+	}
+
+	prLink, _, ok := getPRInfo(*run, app)
+	if !ok {
+		return
+	}
+	plan := ""
+	if run.Plan != nil {
+		plan = *run.Plan
+	}
+	app.comment(*run, prLink, withTimings(gh.DryRunCommentString(plan), *run))
+}
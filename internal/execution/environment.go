@@ -0,0 +1,450 @@
+package execution
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/tools/types"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+	"github.com/supabase/supabench/internal/redact"
+	"github.com/supabase/supabench/internal/terraform"
+	"github.com/supabase/supabench/models"
+)
+
+// Benchmarks may split their script into a long-lived environment module,
+// the system under test, and a per-run load module. The environment is kept
+// up across queued runs of the same script and vars; its outputs are passed
+// to the load module as vars.
+const (
+	environmentModule = "environment"
+	loadModule        = "load"
+)
+
+// Environment statuses.
+const (
+	EnvironmentUp        = "up"
+	EnvironmentDestroyed = "destroyed"
+)
+
+// leakedEnvironments selects environments whose destroy failed and is
+// retried by the resource reaper.
+var leakedEnvironments = dbx.NewExp(
+	"id NOT IN (SELECT environment_id FROM resources WHERE kind = {:kind} AND status = {:status})",
+	dbx.Params{"kind": ResourceEnvironment, "status": ResourceLeaked},
+)
+
+// ErrSplitTargets is returned for split scripts with targets, which would
+// apply to both modules.
+var ErrSplitTargets = errors.New("terraform targets are not supported for scripts split into environment and load modules")
+
+// isSplit reports whether the unpacked script has separate environment and
+// load modules.
+func isSplit(scriptWD string) bool {
+	return terraform.IsModuleDir(path.Join(scriptWD, environmentModule)) &&
+		terraform.IsModuleDir(path.Join(scriptWD, loadModule))
+}
+
+// scriptVariables returns the variables a run of the unpacked script has to
+// provide. For split scripts the load module variables set from environment
+// outputs are left out.
+func scriptVariables(scriptWD string) ([]terraform.Variable, error) {
+	if !isSplit(scriptWD) {
+		return terraform.Variables(scriptWD)
+	}
+
+	envDir := path.Join(scriptWD, environmentModule)
+	envVars, err := terraform.Variables(envDir)
+	if err != nil {
+		return nil, err
+	}
+	loadVars, err := terraform.Variables(path.Join(scriptWD, loadModule))
+	if err != nil {
+		return nil, err
+	}
+	outputs, err := terraform.OutputNames(envDir)
+	if err != nil {
+		return nil, err
+	}
+
+	byName := map[string]terraform.Variable{}
+	for _, v := range envVars {
+		byName[v.Name] = v
+	}
+	fromEnv := map[string]bool{}
+	for _, name := range outputs {
+		fromEnv[name] = true
+	}
+	for _, v := range loadVars {
+		if !fromEnv[v.Name] {
+			byName[v.Name] = v
+		}
+	}
+
+	vars := make([]terraform.Variable, 0, len(byName))
+	for _, v := range byName {
+		vars = append(vars, v)
+	}
+	sort.Slice(vars, func(i, j int) bool {
+		return vars[i].Name < vars[j].Name
+	})
+	return vars, nil
+}
+
+// scriptModules returns the terraform modules of the unpacked script.
+func scriptModules(scriptWD string) []string {
+	if isSplit(scriptWD) {
+		return []string{path.Join(scriptWD, environmentModule), path.Join(scriptWD, loadModule)}
+	}
+	return []string{scriptWD}
+}
+
+// environmentVars drops the vars that change with every run, so they do
+// not prevent sharing the environment.
+func environmentVars(vars map[string]string) map[string]string {
+	perRun := map[string]bool{}
+	for _, k := range runMetaVars {
+		perRun[k] = k != "benchmark_id"
+	}
+
+	envVars := map[string]string{}
+	for k, v := range vars {
+		if !perRun[k] {
+			envVars[k] = v
+		}
+	}
+	return envVars
+}
+
+// environmentKey identifies environments that can be shared.
+func environmentKey(versionID string, envVars map[string]string) (string, error) {
+	b, err := json.Marshal(envVars)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	h.Write([]byte(versionID))
+	h.Write([]byte{0})
+	h.Write(b)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// appliedVars returns the vars an environment is applied with as json, with
+// the values that come from the secret masked, and the names of those vars.
+func appliedVars(envVars, secretVars, runVars map[string]string) (string, string, error) {
+	vars, err := resolvedVars(envVars, secretVars, runVars)
+	if err != nil {
+		return "", "", err
+	}
+	fromSecret := []string{}
+	for k := range envVars {
+		_, inSecret := secretVars[k]
+		_, inRun := runVars[k]
+		if inSecret && !inRun {
+			fromSecret = append(fromSecret, k)
+		}
+	}
+	sort.Strings(fromSecret)
+	b, err := json.Marshal(fromSecret)
+	if err != nil {
+		return "", "", err
+	}
+	return vars, string(b), nil
+}
+
+// destroyVars returns the vars to destroy an environment with: the ones it
+// was applied with, with the masked values read from the current vars.
+func destroyVars(env *models.Environment, current map[string]string) (map[string]string, error) {
+	var fromSecret []string
+	if env.SecretVars != nil {
+		if err := json.Unmarshal([]byte(*env.SecretVars), &fromSecret); err != nil {
+			return nil, err
+		}
+	}
+	vars := getVars(env.Vars)
+	for _, k := range fromSecret {
+		if v, ok := current[k]; ok {
+			vars[k] = v
+		} else {
+			delete(vars, k)
+		}
+	}
+	return vars, nil
+}
+
+// environmentIdleTimeout is how long an unused environment is kept up,
+// configured with SUPABENCH_ENVIRONMENT_IDLE_TIMEOUT.
+func environmentIdleTimeout() time.Duration {
+	if d := viper.GetDuration("ENVIRONMENT_IDLE_TIMEOUT"); d > 0 {
+		return d
+	}
+	return 15 * time.Minute
+}
+
+// runSplit provisions or reuses the environment of a split script and
+// applies the load module against it.
+func (app *App) runSplit(ctx context.Context, run *models.Run, scriptWD, versionID string,
+	envs, vars, secretVars map[string]string, opts terraform.ExecOptions, r *redact.Redactor) error {
+	if len(opts.Targets) > 0 {
+		return ErrSplitTargets
+	}
+	envVars := environmentVars(vars)
+	key, err := environmentKey(versionID, envVars)
+	if err != nil {
+		return err
+	}
+
+	env, err := app.findEnvironment(run.BenchmarkID)
+	if err != nil {
+		return err
+	}
+	if env != nil && env.Key != key {
+		log.Info().Str("environment_id", env.Id).Msg("environment does not match run, destroying")
+		if err := app.destroyEnvironment(env); err != nil {
+			return err
+		}
+		env = nil
+	}
+
+	loadWD := path.Join(scriptWD, loadModule)
+	reused := env != nil
+	if !reused {
+		// the environment is recorded before it is applied, so that
+		// whatever gets created is destroyed once it is idle
+		applied, fromSecret, err := appliedVars(envVars, secretVars, getVars(run.Vars))
+		if err != nil {
+			return err
+		}
+		env = &models.Environment{
+			BenchmarkID: run.BenchmarkID,
+			Key:         key,
+			RunID:       run.Id,
+			Status:      EnvironmentUp,
+			LastUsedAt:  types.NowDateTime(),
+			Vars:        &applied,
+			SecretVars:  &fromSecret,
+		}
+		env.RefreshId()
+		env.RefreshCreated()
+		env.RefreshUpdated()
+		if err := app.PB.DB().Model(env).Insert(); err != nil {
+			return err
+		}
+
+		// the whole script is kept, the module may refer to files and
+		// modules next to it
+		if err := copyDir(scriptWD, environmentDir(env.Id)); err != nil {
+			return err
+		}
+	} else {
+		log.Info().Str("environment_id", env.Id).Msg("reusing environment")
+	}
+	envWD := environmentWD(env.Id)
+
+	run.EnvironmentID = &env.Id
+	if err := app.PB.DB().Model(run).Update("EnvironmentID"); err != nil {
+		return err
+	}
+	defer app.touchEnvironment(env)
+
+	if err := app.phase(run, PhaseInit, func() error {
+		if !reused {
+			if err := app.TF.Init(ctx, envWD, opts); err != nil {
+				return r.Error(err)
+			}
+		}
+		return r.Error(app.TF.Init(ctx, loadWD, opts))
+	}); err != nil {
+		return err
+	}
+
+	if !reused {
+		res := app.trackResources(run, ResourceEnvironment, envWD, env.Id)
+		err := app.phase(run, PhaseProvision, func() error {
+			return r.Error(app.TF.Apply(ctx, envWD, envs, terraform.DeclaredOnly(envWD, envVars), opts, r))
+		})
+		app.refreshResources(res)
+		if err != nil {
+			return err
+		}
+	}
+
+	loadVars, err := app.loadVars(ctx, envWD, loadWD, vars, r)
+	if err != nil {
+		return err
+	}
+	res := app.trackResources(run, ResourceRun, loadWD, "")
+	err = app.phase(run, PhaseLoad, func() error {
+		return r.Error(app.TF.Apply(ctx, loadWD, envs, loadVars, opts, r))
+	})
+	app.refreshResources(res)
+	app.saveOutputs(run, r, envWD, loadWD)
+	app.reloadRun(run)
+	return err
+}
+
+// teardownSplit destroys the load module of a split script run and leaves
+// the environment up for the next run.
+func (app *App) teardownSplit(run *models.Run, scriptWD string, envs, vars map[string]string,
+	r *redact.Redactor) error {
+	envWD := environmentWD(*run.EnvironmentID)
+	loadWD := path.Join(scriptWD, loadModule)
+
+	loadVars, err := app.loadVars(context.Background(), envWD, loadWD, vars, r)
+	if err != nil {
+		return err
+	}
+	if err := app.phase(run, PhaseTeardown, func() error {
+		return r.Error(app.TF.Destroy(loadWD, envs, loadVars, app.destroyOptions(run.BenchmarkID), r))
+	}); err != nil {
+		return err
+	}
+
+	if env, err := app.findEnvironment(run.BenchmarkID); err == nil && env != nil {
+		app.touchEnvironment(env)
+	}
+	return nil
+}
+
+// loadVars adds the environment outputs to the run vars and keeps the ones
+// the load module declares. Sensitive outputs are redacted from logs.
+func (app *App) loadVars(ctx context.Context, envWD, loadWD string, vars map[string]string,
+	r *redact.Redactor) (map[string]string, error) {
+	outputs, err := app.TF.Outputs(ctx, envWD)
+	if err != nil {
+		return nil, r.Error(err)
+	}
+
+	loadVars := map[string]string{}
+	for k, v := range vars {
+		loadVars[k] = v
+	}
+	for name, o := range outputs {
+		if o.Sensitive {
+			r.Add(o.Value)
+		}
+		loadVars[name] = o.Value
+	}
+	return terraform.DeclaredOnly(loadWD, loadVars), nil
+}
+
+// reapEnvironments destroys environments that were not used for longer than
+// the idle timeout. Environments are never destroyed under a running run.
+func (app *App) reapEnvironments() {
+	if app.PB.DB() == nil {
+		return
+	}
+
+	running, err := app.executorBusy()
+	if err != nil {
+		log.Error().Err(err).Msg("error checking if there is a running benchmark")
+		return
+	}
+	if running {
+		return
+	}
+
+	idleSince, _ := types.ParseDateTime(time.Now().UTC().Add(-environmentIdleTimeout()))
+
+	var envs []models.Environment
+	if err := app.PB.DB().
+		Select().
+		Where(dbx.HashExp{"status": EnvironmentUp}).
+		AndWhere(dbx.NewExp("last_used_at < {:since}", dbx.Params{"since": idleSince.String()})).
+		AndWhere(leakedEnvironments).
+		All(&envs); err != nil {
+		log.Error().Err(err).Msg("error finding idle environments")
+		return
+	}
+
+	for i := range envs {
+		log.Info().
+			Str("benchmark_id", envs[i].BenchmarkID).
+			Str("environment_id", envs[i].Id).
+			Msg("destroying idle environment")
+		if err := app.destroyEnvironment(&envs[i]); err != nil {
+			log.Error().Err(err).Str("environment_id", envs[i].Id).Msg("error destroying environment")
+		}
+	}
+}
+
+// destroyEnvironment destroys the environment with the vars it was applied
+// with.
+func (app *App) destroyEnvironment(env *models.Environment) error {
+	_, secret, err := app.getSecretPath(env.BenchmarkID)
+	if err != nil {
+		return err
+	}
+	r := newRedactor(app, secret)
+	envWD := environmentWD(env.Id)
+
+	vars := app.baseVars(env.BenchmarkID, secret)
+	if env.Vars != nil {
+		if vars, err = destroyVars(env, vars); err != nil {
+			return err
+		}
+	} else {
+		// recorded before the applied vars were, use the vars of the run
+		// that created it
+		var run models.Run
+		if err := app.PB.DB().
+			Select().
+			Where(dbx.HashExp{"id": env.RunID}).
+			One(&run); err == nil {
+			for k, v := range getVars(run.Vars) {
+				vars[k] = v
+			}
+		}
+		vars["benchmark_id"] = env.BenchmarkID
+	}
+
+	if terraform.IsModuleDir(envWD) {
+		if err := app.TF.Destroy(envWD, getEnvs(secret.Env), terraform.DeclaredOnly(envWD, vars), app.destroyOptions(env.BenchmarkID), r); err != nil {
+			err = r.Error(err)
+			app.leakResources(env.RunID, ResourceEnvironment, err)
+			return err
+		}
+	}
+	app.releaseResources(env.RunID, ResourceEnvironment)
+	if err := os.RemoveAll(environmentDir(env.Id)); err != nil {
+		log.Warn().Err(err).Msg("cannot remove environment dir")
+	}
+
+	env.Status = EnvironmentDestroyed
+	env.RefreshUpdated()
+	return app.PB.DB().Model(env).Update("Status", "Updated")
+}
+
+func (app *App) touchEnvironment(env *models.Environment) {
+	env.LastUsedAt = types.NowDateTime()
+	env.RefreshUpdated()
+	if err := app.PB.DB().Model(env).Update("LastUsedAt", "Updated"); err != nil {
+		log.Error().Err(err).Str("environment_id", env.Id).Msg("error updating environment")
+	}
+}
+
+// findEnvironment returns the environment of the benchmark that is up, if
+// any.
+func (app *App) findEnvironment(benchmarkID string) (*models.Environment, error) {
+	var env models.Environment
+	if err := app.PB.DB().
+		Select().
+		Where(dbx.HashExp{"benchmark_id": benchmarkID, "status": EnvironmentUp}).
+		AndWhere(leakedEnvironments).
+		One(&env); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &env, nil
+}
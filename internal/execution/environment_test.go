@@ -0,0 +1,115 @@
+package execution
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/supabase/supabench/models"
+)
+
+func TestEnvironmentKey(t *testing.T) {
+	run := func(id, name string) map[string]string {
+		return environmentVars(map[string]string{
+			"benchmark_id": "b1",
+			"testrun_id":   id,
+			"testrun_name": name,
+			"test_origin":  "ci",
+			"rps":          "100",
+		})
+	}
+	key := func(versionID string, vars map[string]string) string {
+		k, err := environmentKey(versionID, vars)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return k
+	}
+
+	if got, want := run("r1", "pr-1"), map[string]string{"benchmark_id": "b1", "rps": "100"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("environmentVars() = %v, want %v", got, want)
+	}
+
+	tests := []struct {
+		name string
+		a, b string
+		same bool
+	}{
+		{name: "next run", a: key("v1", run("r1", "pr-1")), b: key("v1", run("r2", "pr-2")), same: true},
+		{name: "other script version", a: key("v1", run("r1", "pr-1")), b: key("v2", run("r1", "pr-1"))},
+		{name: "other vars", a: key("v1", map[string]string{"rps": "100"}), b: key("v1", map[string]string{"rps": "200"})},
+		{name: "other benchmark", a: key("v1", map[string]string{"benchmark_id": "b1"}), b: key("v1", map[string]string{"benchmark_id": "b2"})},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if (tt.a == tt.b) != tt.same {
+				t.Errorf("environmentKey() equal = %v, want %v", tt.a == tt.b, tt.same)
+			}
+		})
+	}
+}
+
+func TestDestroyVars(t *testing.T) {
+	str := func(s string) *string { return &s }
+
+	tests := []struct {
+		name       string
+		envVars    map[string]string
+		secretVars map[string]string
+		runVars    map[string]string
+		current    map[string]string
+		// wantApplied is what is stored on the environment
+		wantApplied    string
+		wantFromSecret string
+		want           map[string]string
+	}{
+		{
+			name:           "secret values read again",
+			envVars:        map[string]string{"benchmark_id": "b1", "password": "hunter22", "rps": "100"},
+			secretVars:     map[string]string{"password": "hunter22"},
+			current:        map[string]string{"password": "rotated", "rps": "1"},
+			wantApplied:    `{"benchmark_id":"b1","password":"***","rps":"100"}`,
+			wantFromSecret: `["password"]`,
+			want:           map[string]string{"benchmark_id": "b1", "password": "rotated", "rps": "100"},
+		},
+		{
+			name:           "secret overridden by the run",
+			envVars:        map[string]string{"region": "us"},
+			secretVars:     map[string]string{"region": "eu"},
+			runVars:        map[string]string{"region": "us"},
+			current:        map[string]string{"region": "eu"},
+			wantApplied:    `{"region":"us"}`,
+			wantFromSecret: `[]`,
+			want:           map[string]string{"region": "us"},
+		},
+		{
+			name:           "secret var removed since",
+			envVars:        map[string]string{"password": "hunter22", "rps": "100"},
+			secretVars:     map[string]string{"password": "hunter22"},
+			current:        map[string]string{},
+			wantApplied:    `{"password":"***","rps":"100"}`,
+			wantFromSecret: `["password"]`,
+			want:           map[string]string{"rps": "100"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			applied, fromSecret, err := appliedVars(tt.envVars, tt.secretVars, tt.runVars)
+			if err != nil {
+				t.Fatalf("appliedVars() error = %v", err)
+			}
+			if applied != tt.wantApplied || fromSecret != tt.wantFromSecret {
+				t.Fatalf("appliedVars() = %s, %s, want %s, %s", applied, fromSecret, tt.wantApplied, tt.wantFromSecret)
+			}
+
+			got, err := destroyVars(&models.Environment{Vars: str(applied), SecretVars: str(fromSecret)}, tt.current)
+			if err != nil {
+				t.Fatalf("destroyVars() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("destroyVars() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
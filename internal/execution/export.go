@@ -0,0 +1,530 @@
+package execution
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/tools/types"
+	"github.com/supabase/supabench/models"
+)
+
+// exportBatchSize is the number of runs loaded at once during export.
+const exportBatchSize = 100
+
+// ExportFilter selects what Export writes. Empty fields select everything.
+type ExportFilter struct {
+	Project   string
+	Benchmark string
+	Since     types.DateTime
+}
+
+// Export writes projects, benchmarks and their finished runs as JSON lines.
+// Secrets, script versions and values that may carry them, like resolved
+// vars and plans, are left out. Owners are left out too, since users are
+// not moved between instances.
+func (app *App) Export(w io.Writer, f ExportFilter) error {
+	enc := json.NewEncoder(w)
+	now := types.NowDateTime()
+	if err := enc.Encode(models.ExportRecord{
+		Type:       models.ExportHeader,
+		Version:    models.ExportVersion,
+		ExportedAt: &now,
+	}); err != nil {
+		return err
+	}
+
+	projectQuery := app.PB.DB().Select().OrderBy("created")
+	if f.Project != "" {
+		projectQuery.Where(dbx.HashExp{"slug": f.Project})
+	}
+	var projects []models.Project
+	if err := projectQuery.All(&projects); err != nil {
+		return err
+	}
+	projectIDs := []interface{}{}
+	for i := range projects {
+		projects[i].OwnerID = ""
+		projectIDs = append(projectIDs, projects[i].Id)
+		if err := enc.Encode(models.ExportRecord{Type: models.ExportProject, Project: &projects[i]}); err != nil {
+			return err
+		}
+	}
+
+	benchmarkQuery := app.PB.DB().Select().Where(dbx.In("project_id", projectIDs...)).OrderBy("created")
+	if f.Benchmark != "" {
+		benchmarkQuery.AndWhere(dbx.HashExp{"slug": f.Benchmark})
+	}
+	var benchmarks []models.Benchmark
+	if err := benchmarkQuery.All(&benchmarks); err != nil {
+		return err
+	}
+	benchmarkIDs := []interface{}{}
+	for i := range benchmarks {
+		benchmarks[i].OwnerID = ""
+		benchmarkIDs = append(benchmarkIDs, benchmarks[i].Id)
+		if err := enc.Encode(models.ExportRecord{Type: models.ExportBenchmark, Benchmark: &benchmarks[i]}); err != nil {
+			return err
+		}
+	}
+
+	runsExp := dbx.And(
+		dbx.In("benchmark_id", benchmarkIDs...),
+		dbx.In("status", doneStatuses...),
+	)
+	if !f.Since.IsZero() {
+		runsExp = dbx.And(runsExp, dbx.NewExp("triggered_at >= {:since}", dbx.Params{"since": f.Since.String()}))
+	}
+
+	var prIDs []string
+	if err := app.PB.DB().
+		Select("github_pr_id").
+		Distinct(true).
+		From("runs").
+		Where(runsExp).
+		AndWhere(dbx.NewExp("github_pr_id != ''")).
+		Column(&prIDs); err != nil {
+		return err
+	}
+	if len(prIDs) > 0 {
+		ids := make([]interface{}, len(prIDs))
+		for i, id := range prIDs {
+			ids[i] = id
+		}
+		var prs []models.PR
+		if err := app.PB.DB().Select().Where(dbx.In("id", ids...)).All(&prs); err != nil {
+			return err
+		}
+		for i := range prs {
+			if err := enc.Encode(models.ExportRecord{Type: models.ExportPR, PR: &prs[i]}); err != nil {
+				return err
+			}
+		}
+	}
+
+	for offset := int64(0); ; offset += exportBatchSize {
+		var runs []models.Run
+		if err := app.PB.DB().
+			Select().
+			Where(runsExp).
+			OrderBy("triggered_at", "id").
+			Offset(offset).
+			Limit(exportBatchSize).
+			All(&runs); err != nil {
+			return err
+		}
+		for i := range runs {
+			if err := app.exportRun(enc, &runs[i]); err != nil {
+				return err
+			}
+		}
+		if len(runs) < exportBatchSize {
+			return nil
+		}
+	}
+}
+
+func (app *App) exportRun(enc *json.Encoder, run *models.Run) error {
+	run.ResolvedVars = nil
+	run.Plan = nil
+	run.PlanJSON = nil
+	run.ScriptVersionID = nil
+	run.EnvironmentID = nil
+	if err := enc.Encode(models.ExportRecord{Type: models.ExportRun, Run: run}); err != nil {
+		return err
+	}
+
+	var events []models.RunEvent
+	if err := app.PB.DB().
+		Select().
+		Where(dbx.HashExp{"run_id": run.Id}).
+		OrderBy("created").
+		All(&events); err != nil {
+		return err
+	}
+	for i := range events {
+		if err := enc.Encode(models.ExportRecord{Type: models.ExportRunEvent, RunEvent: &events[i]}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Handling of imported records that already exist.
+const (
+	ConflictSkip      = "skip"
+	ConflictOverwrite = "overwrite"
+	ConflictFail      = "fail"
+)
+
+var ErrImportConflict = errors.New("record already exists")
+
+type ImportOptions struct {
+	// OwnerID owns the projects and benchmarks created by the import.
+	OwnerID string
+	// Conflict is what to do with projects, benchmarks and runs that
+	// already exist: skip, overwrite or fail. Defaults to skip.
+	Conflict string
+	DryRun   bool
+}
+
+// Import reads an export, all or nothing. Projects and benchmarks are
+// matched by slug, PRs by link and runs by benchmark, name and trigger
+// time. New records keep their exported IDs
+// unless those are taken, and references are remapped accordingly.
+func (app *App) Import(r io.Reader, opts ImportOptions) (*models.ImportResult, error) {
+	switch opts.Conflict {
+	case "":
+		opts.Conflict = ConflictSkip
+	case ConflictSkip, ConflictOverwrite, ConflictFail:
+	default:
+		return nil, fmt.Errorf("unknown conflict handling %q, expected skip, overwrite or fail", opts.Conflict)
+	}
+
+	result := &models.ImportResult{
+		DryRun: opts.DryRun,
+		Counts: map[string]*models.ImportCount{},
+	}
+	for _, t := range []string{models.ExportProject, models.ExportBenchmark, models.ExportPR, models.ExportRun, models.ExportRunEvent} {
+		result.Counts[t] = &models.ImportCount{}
+	}
+
+	err := app.PB.DB().Transactional(func(tx *dbx.Tx) error {
+		im := importer{
+			tx:         tx,
+			opts:       opts,
+			result:     result,
+			projects:   map[string]string{},
+			benchmarks: map[string]string{},
+			prs:        map[string]string{},
+			runs:       map[string]string{},
+			events:     map[string]string{},
+		}
+
+		dec := json.NewDecoder(r)
+		for line := 1; ; line++ {
+			var rec models.ExportRecord
+			if err := dec.Decode(&rec); err == io.EOF {
+				if line == 1 {
+					return errors.New("empty export")
+				}
+				break
+			} else if err != nil {
+				return fmt.Errorf("line %d: %w", line, err)
+			}
+
+			if line == 1 {
+				if rec.Type != models.ExportHeader {
+					return errors.New("export has no header")
+				}
+				if rec.Version != models.ExportVersion {
+					return fmt.Errorf("unsupported export version %d, expected %d", rec.Version, models.ExportVersion)
+				}
+				continue
+			}
+			if err := im.record(rec); err != nil {
+				return fmt.Errorf("line %d: %w", line, err)
+			}
+		}
+
+		if err := im.remapRunRefs(); err != nil {
+			return err
+		}
+		if opts.DryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if err != nil && err != errDryRun {
+		return nil, err
+	}
+	return result, nil
+}
+
+type importer struct {
+	tx     *dbx.Tx
+	opts   ImportOptions
+	result *models.ImportResult
+
+	// exported IDs mapped to the IDs of the stored records
+	projects   map[string]string
+	benchmarks map[string]string
+	prs        map[string]string
+	runs       map[string]string
+	// runs whose events are imported, by exported ID
+	events map[string]string
+	refs   []runRefs
+}
+
+// runRefs are the exported runs a stored run refers to, remapped once all
+// runs are imported.
+type runRefs struct {
+	id           string
+	sourceRunID  *string
+	supersededBy *string
+}
+
+func (im *importer) record(rec models.ExportRecord) error {
+	switch {
+	case rec.Type == models.ExportProject && rec.Project != nil:
+		return im.project(rec.Project)
+	case rec.Type == models.ExportBenchmark && rec.Benchmark != nil:
+		return im.benchmark(rec.Benchmark)
+	case rec.Type == models.ExportPR && rec.PR != nil:
+		return im.pr(rec.PR)
+	case rec.Type == models.ExportRun && rec.Run != nil:
+		return im.run(rec.Run)
+	case rec.Type == models.ExportRunEvent && rec.RunEvent != nil:
+		return im.runEvent(rec.RunEvent)
+	}
+	return fmt.Errorf("invalid record of type %q", rec.Type)
+}
+
+// conflict handles a record that already exists. It reports whether the
+// record should be overwritten.
+func (im *importer) conflict(kind, name string) (bool, error) {
+	switch im.opts.Conflict {
+	case ConflictFail:
+		return false, fmt.Errorf("%s %s: %w", kind, name, ErrImportConflict)
+	case ConflictOverwrite:
+		im.result.Counts[kind].Updated++
+		return true, nil
+	}
+	im.result.Counts[kind].Skipped++
+	return false, nil
+}
+
+// insert stores a new record under its exported ID, or a new one if that
+// is taken.
+func (im *importer) insert(kind string, m recordModel) error {
+	var n int
+	if err := im.tx.Select("count(*)").From(m.TableName()).Where(dbx.HashExp{"id": m.GetId()}).Row(&n); err != nil {
+		return err
+	}
+	if m.GetId() == "" || n > 0 {
+		m.RefreshId()
+		im.result.Counts[kind].Remapped++
+	}
+	im.result.Counts[kind].Created++
+	return im.tx.Model(m).Insert()
+}
+
+func (im *importer) project(p *models.Project) error {
+	exportedID := p.Id
+
+	var existing models.Project
+	err := im.tx.Select().Where(dbx.HashExp{"slug": p.Slug}).One(&existing)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if err == nil {
+		im.projects[exportedID] = existing.Id
+		overwrite, err := im.conflict(models.ExportProject, p.Slug)
+		if err != nil || !overwrite {
+			return err
+		}
+		existing.Name = p.Name
+		existing.Repo = p.Repo
+		existing.Meta = p.Meta
+		existing.RefreshUpdated()
+		return im.tx.Model(&existing).Update("Name", "Repo", "Meta", "Updated")
+	}
+
+	if im.opts.OwnerID == "" {
+		return fmt.Errorf("project %s: an owner is required to create it", p.Slug)
+	}
+	p.OwnerID = im.opts.OwnerID
+	if err := im.insert(models.ExportProject, p); err != nil {
+		return err
+	}
+	im.projects[exportedID] = p.Id
+	return nil
+}
+
+func (im *importer) benchmark(b *models.Benchmark) error {
+	exportedID := b.Id
+	projectID, ok := im.projects[b.ProjectID]
+	if !ok {
+		return fmt.Errorf("benchmark %s: project %s is not part of the export", b.Slug, b.ProjectID)
+	}
+	b.ProjectID = projectID
+
+	var existing models.Benchmark
+	err := im.tx.Select().Where(dbx.HashExp{"slug": b.Slug}).One(&existing)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if err == nil {
+		im.benchmarks[exportedID] = existing.Id
+		overwrite, err := im.conflict(models.ExportBenchmark, b.Slug)
+		if err != nil || !overwrite {
+			return err
+		}
+		existing.ProjectID = b.ProjectID
+		existing.Name = b.Name
+		existing.GrafanaURL = b.GrafanaURL
+		existing.DefaultOrigin = b.DefaultOrigin
+		existing.ExtractMetricPath = b.ExtractMetricPath
+		existing.Meta = b.Meta
+		existing.RefreshUpdated()
+		return im.tx.Model(&existing).Update(
+			"ProjectID", "Name", "GrafanaURL", "DefaultOrigin", "ExtractMetricPath", "Meta", "Updated",
+		)
+	}
+
+	if im.opts.OwnerID == "" {
+		return fmt.Errorf("benchmark %s: an owner is required to create it", b.Slug)
+	}
+	b.OwnerID = im.opts.OwnerID
+	if err := im.insert(models.ExportBenchmark, b); err != nil {
+		return err
+	}
+	im.benchmarks[exportedID] = b.Id
+	return nil
+}
+
+// pr reuses the PR with the same link, PRs are the same everywhere.
+func (im *importer) pr(p *models.PR) error {
+	exportedID := p.Id
+	if p.PRLink != nil && *p.PRLink != "" {
+		var id string
+		err := im.tx.Select("id").From(p.TableName()).Where(dbx.HashExp{"pr_link": *p.PRLink}).Row(&id)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		if err == nil {
+			im.prs[exportedID] = id
+			im.result.Counts[models.ExportPR].Skipped++
+			return nil
+		}
+	}
+
+	if err := im.insert(models.ExportPR, p); err != nil {
+		return err
+	}
+	im.prs[exportedID] = p.Id
+	return nil
+}
+
+func (im *importer) run(run *models.Run) error {
+	exportedID := run.Id
+	// queued and executing runs belong to the instance they run on
+	if !isDoneStatus(run.Status) {
+		im.result.Counts[models.ExportRun].Skipped++
+		return nil
+	}
+
+	benchmarkID, ok := im.benchmarks[run.BenchmarkID]
+	if !ok {
+		return fmt.Errorf("run %s: benchmark %s is not part of the export", run.Id, run.BenchmarkID)
+	}
+	run.BenchmarkID = benchmarkID
+	if run.GitHubPRID != nil {
+		if id, ok := im.prs[*run.GitHubPRID]; ok {
+			run.GitHubPRID = &id
+		} else {
+			run.GitHubPRID = nil
+		}
+	}
+	refs := runRefs{sourceRunID: run.SourceRunID, supersededBy: run.SupersededBy}
+	run.SourceRunID = nil
+	run.SupersededBy = nil
+	run.ScriptVersionID = nil
+	run.EnvironmentID = nil
+
+	var existing models.Run
+	err := im.tx.Select().
+		Where(dbx.HashExp{"benchmark_id": run.BenchmarkID, "name": run.Name}).
+		// compare as times, the format of stored dates differs by version
+		AndWhere(dbx.NewExp(
+			"strftime('%Y-%m-%d %H:%M:%f', triggered_at) = strftime('%Y-%m-%d %H:%M:%f', {:triggered_at})",
+			dbx.Params{"triggered_at": run.TriggeredAt.String()},
+		)).
+		One(&existing)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if err == nil {
+		im.runs[exportedID] = existing.Id
+		overwrite, err := im.conflict(models.ExportRun, run.Name)
+		if err != nil || !overwrite {
+			return err
+		}
+		// only exported columns are overwritten, local state like the
+		// script version, pins and compaction is kept
+		run.Id = existing.Id
+		run.RefreshUpdated()
+		if err := im.tx.Model(run).Update(
+			"Origin", "Status", "StartedAt", "EndedAt", "Output", "Errors", "Meta", "Raw", "Comment",
+			"Vars", "GitHubPRID", "Priority", "ExecutedAt", "FinishedAt", "ExternalID", "Phases",
+			"DryRun", "Outputs", "LoadStartedAt", "LoadEndedAt", "Updated",
+		); err != nil {
+			return err
+		}
+		if _, err := im.tx.Delete(models.RunEvent{}.TableName(), dbx.HashExp{"run_id": run.Id}).Execute(); err != nil {
+			return err
+		}
+	} else if err := im.insert(models.ExportRun, run); err != nil {
+		return err
+	}
+
+	im.runs[exportedID] = run.Id
+	im.events[exportedID] = run.Id
+	refs.id = run.Id
+	im.refs = append(im.refs, refs)
+	return nil
+}
+
+// runEvent stores the event of a run that was created or overwritten.
+func (im *importer) runEvent(e *models.RunEvent) error {
+	runID, ok := im.events[e.RunID]
+	if !ok {
+		im.result.Counts[models.ExportRunEvent].Skipped++
+		return nil
+	}
+	e.RunID = runID
+	return im.insert(models.ExportRunEvent, e)
+}
+
+// remapRunRefs points reruns and superseded runs to the stored runs. Runs
+// that are not part of the import are dropped from the references.
+func (im *importer) remapRunRefs() error {
+	for _, refs := range im.refs {
+		run := models.Run{
+			SourceRunID:  im.remapRun(refs.sourceRunID),
+			SupersededBy: im.remapRun(refs.supersededBy),
+		}
+		if run.SourceRunID == nil && run.SupersededBy == nil {
+			continue
+		}
+		run.Id = refs.id
+		if err := im.tx.Model(&run).Update("SourceRunID", "SupersededBy"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// remapRun returns the stored ID of the exported run, or nil if it was not
+// imported.
+func (im *importer) remapRun(id *string) *string {
+	if id == nil {
+		return nil
+	}
+	if stored, ok := im.runs[*id]; ok {
+		return &stored
+	}
+	return nil
+}
+
+func isDoneStatus(status string) bool {
+	for _, s := range doneStatuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
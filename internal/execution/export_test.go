@@ -0,0 +1,87 @@
+package execution
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/supabase/supabench/models"
+)
+
+func TestImportConflict(t *testing.T) {
+	tests := []struct {
+		mode          string
+		wantOverwrite bool
+		wantErr       error
+		wantCount     models.ImportCount
+	}{
+		{mode: ConflictSkip, wantCount: models.ImportCount{Skipped: 1}},
+		{mode: ConflictOverwrite, wantOverwrite: true, wantCount: models.ImportCount{Updated: 1}},
+		{mode: ConflictFail, wantErr: ErrImportConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			im := importer{
+				opts:   ImportOptions{Conflict: tt.mode},
+				result: &models.ImportResult{Counts: map[string]*models.ImportCount{models.ExportRun: {}}},
+			}
+			overwrite, err := im.conflict(models.ExportRun, "pr-1")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("conflict() error = %v, want %v", err, tt.wantErr)
+			}
+			if overwrite != tt.wantOverwrite {
+				t.Errorf("conflict() = %v, want %v", overwrite, tt.wantOverwrite)
+			}
+			if got := *im.result.Counts[models.ExportRun]; got != tt.wantCount {
+				t.Errorf("counts = %+v, want %+v", got, tt.wantCount)
+			}
+		})
+	}
+}
+
+func TestImportUnknownConflict(t *testing.T) {
+	_, err := (&App{}).Import(strings.NewReader(""), ImportOptions{Conflict: "merge"})
+	if err == nil || !strings.Contains(err.Error(), `unknown conflict handling "merge"`) {
+		t.Fatalf("Import() error = %v, want unknown conflict handling", err)
+	}
+}
+
+func TestRemapRun(t *testing.T) {
+	str := func(s string) *string { return &s }
+	im := importer{runs: map[string]string{"exported": "stored", "kept": "kept"}}
+
+	tests := []struct {
+		name string
+		id   *string
+		want *string
+	}{
+		{name: "no reference", id: nil, want: nil},
+		{name: "remapped", id: str("exported"), want: str("stored")},
+		{name: "same id", id: str("kept"), want: str("kept")},
+		{name: "not imported", id: str("missing"), want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := im.remapRun(tt.id)
+			if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+				t.Errorf("remapRun() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsDoneStatus(t *testing.T) {
+	for status, want := range map[string]bool{
+		StatusFinished:    true,
+		StatusCancelled:   true,
+		StatusPending:     false,
+		StatusRunning:     false,
+		StatusTearingDown: false,
+	} {
+		if got := isDoneStatus(status); got != want {
+			t.Errorf("isDoneStatus(%q) = %v, want %v", status, got, want)
+		}
+	}
+}
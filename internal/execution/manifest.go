@@ -0,0 +1,446 @@
+package execution
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"reflect"
+
+	"github.com/pocketbase/dbx"
+	"github.com/rs/zerolog/log"
+	"github.com/supabase/supabench/models"
+	"gopkg.in/yaml.v3"
+)
+
+// Manifest change actions.
+const (
+	ActionCreate    = "create"
+	ActionUpdate    = "update"
+	ActionUnchanged = "unchanged"
+)
+
+var ErrNotOwner = errors.New("record is owned by another user")
+
+// ParseManifest reads a YAML manifest. JSON is accepted as well.
+func ParseManifest(b []byte) (*models.Manifest, error) {
+	var m models.Manifest
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	if err := dec.Decode(&m); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	if err := ValidateManifest(&m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// ValidateManifest checks the manifest before anything is applied.
+func ValidateManifest(m *models.Manifest) error {
+	if m.Version != models.ManifestVersion {
+		return fmt.Errorf("unsupported manifest version %d, expected %d", m.Version, models.ManifestVersion)
+	}
+
+	projects := map[string]bool{}
+	benchmarks := map[string]bool{}
+	for _, p := range m.Projects {
+		if p.Slug == "" || p.Name == "" {
+			return errors.New("projects need a slug and a name")
+		}
+		if projects[p.Slug] {
+			return fmt.Errorf("duplicate project %s", p.Slug)
+		}
+		projects[p.Slug] = true
+
+		for _, b := range p.Benchmarks {
+			if b.Slug == "" || b.Name == "" {
+				return fmt.Errorf("benchmarks of project %s need a slug and a name", p.Slug)
+			}
+			if benchmarks[b.Slug] {
+				return fmt.Errorf("duplicate benchmark %s", b.Slug)
+			}
+			benchmarks[b.Slug] = true
+
+			for _, name := range b.RemoveVars {
+				if _, ok := b.Vars[name]; ok {
+					return fmt.Errorf("benchmark %s: var %s is both set and removed", b.Slug, name)
+				}
+			}
+			for _, t := range b.Thresholds {
+				if t.Metric == "" || t.MaxRegression < 0 {
+					return fmt.Errorf("benchmark %s: thresholds need a metric and a non-negative max_regression", b.Slug)
+				}
+			}
+			if b.Meta != nil {
+				meta, err := jsonString(b.Meta)
+				if err != nil {
+					return fmt.Errorf("benchmark %s: %w", b.Slug, err)
+				}
+				if _, err := BenchmarkExecOptions(&meta); err != nil {
+					return fmt.Errorf("benchmark %s: %w", b.Slug, err)
+				}
+				if _, ok := b.Meta["vars"]; ok {
+					return fmt.Errorf("benchmark %s: set vars with vars instead of meta", b.Slug)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// ApplyManifest creates or updates the projects, benchmarks and their vars
+// described by the manifest, all or nothing. New records are owned by
+// ownerID. If restrict is set, records owned by other users are not
+// changed. Nothing is deleted and secret env is never touched.
+func (app *App) ApplyManifest(m *models.Manifest, ownerID string, restrict, dryRun bool) (*models.ManifestResult, error) {
+	result := &models.ManifestResult{
+		DryRun:  dryRun,
+		Changes: []models.ManifestChange{},
+		Scripts: []models.ManifestScript{},
+	}
+
+	a := applier{ownerID: ownerID, restrict: restrict, dryRun: dryRun, result: result}
+	err := app.PB.DB().Transactional(func(tx *dbx.Tx) error {
+		a.tx = tx
+		for _, p := range m.Projects {
+			project, err := a.project(p)
+			if err != nil {
+				return err
+			}
+			for _, b := range p.Benchmarks {
+				benchmark, err := a.benchmark(project.Id, b)
+				if err != nil {
+					return err
+				}
+				secret, err := a.secret(benchmark.Id, b)
+				if err != nil {
+					return err
+				}
+				if b.Script != nil {
+					script := models.ManifestScript{Benchmark: b.Slug}
+					if secret != nil {
+						script.SecretID = secret.Id
+					}
+					result.Scripts = append(result.Scripts, script)
+				}
+			}
+		}
+		if dryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if err != nil && err != errDryRun {
+		return nil, err
+	}
+	if !dryRun {
+		app.revalidate(a.varsChanged)
+	}
+
+	for i, s := range result.Scripts {
+		if s.SecretID == "" {
+			continue
+		}
+		hash, err := app.scriptHash(s.SecretID)
+		if err != nil {
+			return nil, err
+		}
+		result.Scripts[i].Hash = hash
+	}
+	return result, nil
+}
+
+// revalidate validates the scripts of the benchmarks again in the
+// background, the vars they provide are part of the report. Applies go
+// around the secret hooks that do this on upload.
+func (app *App) revalidate(benchmarkIDs []string) {
+	for _, id := range benchmarkIDs {
+		secret, err := app.findSecret(id)
+		if err != nil || secret.Script == nil || *secret.Script == "" {
+			continue
+		}
+		go func(id string) {
+			if _, err := app.ValidateSecret(id); err != nil {
+				log.Error().Err(err).Str("secret_id", id).Msg("error validating script")
+			}
+		}(secret.Id)
+	}
+}
+
+// errDryRun rolls back the changes of a dry run.
+var errDryRun = errors.New("dry run")
+
+// scriptHash returns the hash of the current script of the secret, or an
+// empty string if it has none.
+func (app *App) scriptHash(secretID string) (string, error) {
+	basePath, secret, err := app.getSecretByID(secretID)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if secret.Script == nil || *secret.Script == "" {
+		return "", nil
+	}
+	return fileHash(path.Join(basePath, *secret.Script))
+}
+
+type applier struct {
+	tx       *dbx.Tx
+	ownerID  string
+	restrict bool
+	dryRun   bool
+	result   *models.ManifestResult
+	// benchmarks whose vars changed, their scripts are validated again
+	varsChanged []string
+}
+
+// changes collects the struct fields to update and their json names to
+// report.
+type changes struct {
+	attrs  []string
+	fields []string
+}
+
+func (c *changes) add(attr, field string) {
+	c.attrs = append(c.attrs, attr)
+	c.fields = append(c.fields, field)
+}
+
+func (c *changes) setString(attr, field string, cur *string, want string) {
+	if *cur != want {
+		*cur = want
+		c.add(attr, field)
+	}
+}
+
+// setOptional changes an optional field if the manifest sets it.
+func (c *changes) setOptional(attr, field string, cur **string, want *string) {
+	if want == nil {
+		return
+	}
+	if *cur == nil || **cur != *want {
+		v := *want
+		*cur = &v
+		c.add(attr, field)
+	}
+}
+
+func (a *applier) record(kind, slug, id string, created bool, c changes) {
+	change := models.ManifestChange{Kind: kind, Slug: slug, ID: id, Fields: c.fields}
+	switch {
+	case created:
+		change.Action = ActionCreate
+		if a.dryRun {
+			change.ID = ""
+		}
+	case len(c.fields) > 0:
+		change.Action = ActionUpdate
+	default:
+		change.Action = ActionUnchanged
+	}
+	a.result.Changes = append(a.result.Changes, change)
+}
+
+func (a *applier) checkOwner(kind, slug, ownerID string) error {
+	if a.restrict && ownerID != a.ownerID {
+		return fmt.Errorf("%s %s: %w", kind, slug, ErrNotOwner)
+	}
+	return nil
+}
+
+func (a *applier) project(p models.ManifestProject) (*models.Project, error) {
+	var project models.Project
+	err := a.tx.Select().Where(dbx.HashExp{"slug": p.Slug}).One(&project)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	created := err == sql.ErrNoRows
+	if created {
+		project = models.Project{OwnerID: a.ownerID, Slug: p.Slug}
+		project.RefreshId()
+	} else if err := a.checkOwner("project", p.Slug, project.OwnerID); err != nil {
+		return nil, err
+	}
+
+	c := changes{}
+	c.setString("Name", "name", &project.Name, p.Name)
+	c.setOptional("Repo", "repo", &project.Repo, p.Repo)
+	if p.Meta != nil {
+		meta, err := jsonString(p.Meta)
+		if err != nil {
+			return nil, err
+		}
+		if project.Meta == nil || !sameJSON(*project.Meta, meta) {
+			project.Meta = &meta
+			c.add("Meta", "meta")
+		}
+	}
+
+	if err := a.save(&project, created, c); err != nil {
+		return nil, err
+	}
+	a.record("project", p.Slug, project.Id, created, c)
+	return &project, nil
+}
+
+func (a *applier) benchmark(projectID string, b models.ManifestBenchmark) (*models.Benchmark, error) {
+	var benchmark models.Benchmark
+	err := a.tx.Select().Where(dbx.HashExp{"slug": b.Slug}).One(&benchmark)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	created := err == sql.ErrNoRows
+	if created {
+		benchmark = models.Benchmark{OwnerID: a.ownerID, Slug: b.Slug}
+		benchmark.RefreshId()
+	} else if err := a.checkOwner("benchmark", b.Slug, benchmark.OwnerID); err != nil {
+		return nil, err
+	}
+
+	c := changes{}
+	c.setString("ProjectID", "project_id", &benchmark.ProjectID, projectID)
+	c.setString("Name", "name", &benchmark.Name, b.Name)
+	c.setOptional("GrafanaURL", "grafana_url", &benchmark.GrafanaURL, b.GrafanaURL)
+	c.setOptional("DefaultOrigin", "default_origin", &benchmark.DefaultOrigin, b.DefaultOrigin)
+	c.setOptional("ExtractMetricPath", "extract_metric_path", &benchmark.ExtractMetricPath, b.ExtractMetricPath)
+	if b.Meta != nil || b.Thresholds != nil || b.Vars != nil || b.RemoveVars != nil {
+		meta, err := benchmarkMeta(benchmark.Meta, b)
+		if err != nil {
+			return nil, err
+		}
+		if benchmark.Meta == nil || !sameJSON(*benchmark.Meta, meta) {
+			before, _ := BenchmarkVars(benchmark.Meta)
+			after, _ := BenchmarkVars(&meta)
+			if !reflect.DeepEqual(before, after) {
+				a.varsChanged = append(a.varsChanged, benchmark.Id)
+			}
+			benchmark.Meta = &meta
+			c.add("Meta", "meta")
+		}
+	}
+
+	if err := a.save(&benchmark, created, c); err != nil {
+		return nil, err
+	}
+	a.record("benchmark", b.Slug, benchmark.Id, created, c)
+	return &benchmark, nil
+}
+
+// secret returns the secret to upload the script of the benchmark to,
+// creating it if needed. Benchmarks without script in the manifest are left
+// alone.
+func (a *applier) secret(benchmarkID string, b models.ManifestBenchmark) (*models.Secret, error) {
+	if b.Script == nil {
+		return nil, nil
+	}
+
+	var secret models.Secret
+	err := a.tx.Select().Where(dbx.HashExp{"benchmark_id": benchmarkID}).One(&secret)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	created := err == sql.ErrNoRows
+	if created {
+		secret = models.Secret{OwnerID: a.ownerID, BenchmarkID: benchmarkID}
+		secret.RefreshId()
+	} else if err := a.checkOwner("secret", b.Slug, secret.OwnerID); err != nil {
+		return nil, err
+	}
+
+	c := changes{}
+	if err := a.save(&secret, created, c); err != nil {
+		return nil, err
+	}
+	a.record("secret", b.Slug, secret.Id, created, c)
+	if created && a.dryRun {
+		return nil, nil
+	}
+	return &secret, nil
+}
+
+// recordModel is a model of a collection record.
+type recordModel interface {
+	dbx.TableModel
+	GetId() string
+	RefreshId()
+	RefreshCreated()
+	RefreshUpdated()
+}
+
+func (a *applier) save(m recordModel, created bool, c changes) error {
+	if created {
+		m.RefreshCreated()
+		m.RefreshUpdated()
+		return a.tx.Model(m).Insert()
+	}
+	if len(c.attrs) == 0 {
+		return nil
+	}
+	m.RefreshUpdated()
+	return a.tx.Model(m).Update(append(c.attrs, "Updated")...)
+}
+
+// benchmarkMeta replaces the stored meta with the one of the manifest, if
+// set, stores the thresholds in it and merges the manifest vars into its
+// vars. Vars the manifest does not mention are kept.
+func benchmarkMeta(current *string, b models.ManifestBenchmark) (string, error) {
+	meta := map[string]interface{}{}
+	if current != nil && *current != "" {
+		if err := json.Unmarshal([]byte(*current), &meta); err != nil {
+			// meta is free-form, start over if it is not an object
+			meta = map[string]interface{}{}
+		}
+	}
+	vars, err := BenchmarkVars(current)
+	if err != nil {
+		return "", err
+	}
+
+	if b.Meta != nil {
+		meta = map[string]interface{}{}
+		for k, v := range b.Meta {
+			meta[k] = v
+		}
+	}
+	if b.Thresholds != nil {
+		meta["thresholds"] = b.Thresholds
+	}
+
+	for k, v := range b.Vars {
+		vars[k] = v
+	}
+	for _, k := range b.RemoveVars {
+		delete(vars, k)
+	}
+	if len(vars) > 0 {
+		meta["vars"] = vars
+	} else {
+		delete(meta, "vars")
+	}
+	return jsonString(meta)
+}
+
+func jsonString(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// sameJSON compares two json documents regardless of formatting and key
+// order.
+func sameJSON(a, b string) bool {
+	var va, vb interface{}
+	if json.Unmarshal([]byte(a), &va) != nil || json.Unmarshal([]byte(b), &vb) != nil {
+		return a == b
+	}
+	ca, _ := json.Marshal(va)
+	cb, _ := json.Marshal(vb)
+	return bytes.Equal(ca, cb)
+}
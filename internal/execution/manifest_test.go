@@ -0,0 +1,229 @@
+package execution
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/supabase/supabench/models"
+)
+
+func TestParseManifest(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		wantErr string
+	}{
+		{
+			name: "valid",
+			in: `
+version: 1
+owner: ci@example.com
+projects:
+  - slug: realtime
+    name: Realtime
+    benchmarks:
+      - slug: broadcast
+        name: Broadcast
+        thresholds:
+          - metric: http_req_duration.p(95)
+            max_regression: 10
+        meta:
+          terraform: {parallelism: 10}
+        vars:
+          rps: "100"
+        remove_vars: [duration]
+`,
+		},
+		{
+			name:    "unknown field",
+			in:      "version: 1\nprojects: []\nextra: true\n",
+			wantErr: "invalid manifest",
+		},
+		{
+			name:    "unsupported version",
+			in:      "version: 2\nprojects: []\n",
+			wantErr: "unsupported manifest version 2",
+		},
+		{
+			name:    "project without name",
+			in:      "version: 1\nprojects:\n  - slug: p\n",
+			wantErr: "projects need a slug and a name",
+		},
+		{
+			name:    "duplicate project",
+			in:      "version: 1\nprojects:\n  - {slug: p, name: P}\n  - {slug: p, name: Q}\n",
+			wantErr: "duplicate project p",
+		},
+		{
+			name: "duplicate benchmark across projects",
+			in: `
+version: 1
+projects:
+  - slug: p
+    name: P
+    benchmarks: [{slug: b, name: B}]
+  - slug: q
+    name: Q
+    benchmarks: [{slug: b, name: B}]
+`,
+			wantErr: "duplicate benchmark b",
+		},
+		{
+			name: "var set and removed",
+			in: `
+version: 1
+projects:
+  - slug: p
+    name: P
+    benchmarks:
+      - {slug: b, name: B, vars: {rps: "1"}, remove_vars: [rps]}
+`,
+			wantErr: "var rps is both set and removed",
+		},
+		{
+			name: "negative threshold",
+			in: `
+version: 1
+projects:
+  - slug: p
+    name: P
+    benchmarks:
+      - {slug: b, name: B, thresholds: [{metric: m, max_regression: -1}]}
+`,
+			wantErr: "non-negative max_regression",
+		},
+		{
+			name: "unsupported terraform option",
+			in: `
+version: 1
+projects:
+  - slug: p
+    name: P
+    benchmarks:
+      - {slug: b, name: B, meta: {terraform: {backend: s3}}}
+`,
+			wantErr: "benchmark b",
+		},
+		{
+			name: "vars in meta",
+			in: `
+version: 1
+projects:
+  - slug: p
+    name: P
+    benchmarks:
+      - {slug: b, name: B, meta: {vars: {rps: "1"}}}
+`,
+			wantErr: "set vars with vars instead of meta",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseManifest([]byte(tt.in))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("ParseManifest() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("ParseManifest() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBenchmarkMeta(t *testing.T) {
+	str := func(s string) *string { return &s }
+
+	tests := []struct {
+		name      string
+		current   *string
+		benchmark models.ManifestBenchmark
+		want      string
+	}{
+		{
+			name:      "new vars",
+			current:   nil,
+			benchmark: models.ManifestBenchmark{Vars: map[string]string{"rps": "100"}},
+			want:      `{"vars":{"rps":"100"}}`,
+		},
+		{
+			name:      "vars merged and removed",
+			current:   str(`{"team":"realtime","vars":{"rps":"10","duration":"60","region":"eu"}}`),
+			benchmark: models.ManifestBenchmark{Vars: map[string]string{"rps": "100"}, RemoveVars: []string{"duration"}},
+			want:      `{"team":"realtime","vars":{"region":"eu","rps":"100"}}`,
+		},
+		{
+			name:      "meta replaced, vars kept",
+			current:   str(`{"team":"realtime","vars":{"rps":"10"}}`),
+			benchmark: models.ManifestBenchmark{Meta: map[string]interface{}{"team": "storage"}},
+			want:      `{"team":"storage","vars":{"rps":"10"}}`,
+		},
+		{
+			name:    "thresholds stored",
+			current: str(`{"team":"realtime"}`),
+			benchmark: models.ManifestBenchmark{Thresholds: []models.Threshold{
+				{Metric: "http_req_duration.p(95)", MaxRegression: 10, LowerIsBetter: true},
+			}},
+			want: `{"team":"realtime","thresholds":[{"metric":"http_req_duration.p(95)","max_regression":10,"lower_is_better":true}]}`,
+		},
+		{
+			name:      "last var removed",
+			current:   str(`{"vars":{"rps":"10"}}`),
+			benchmark: models.ManifestBenchmark{RemoveVars: []string{"rps"}},
+			want:      `{}`,
+		},
+		{
+			name:      "meta not an object",
+			current:   str(`[1,2]`),
+			benchmark: models.ManifestBenchmark{Vars: map[string]string{"rps": "100"}},
+			want:      `{"vars":{"rps":"100"}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := benchmarkMeta(tt.current, tt.benchmark)
+			if err != nil {
+				t.Fatalf("benchmarkMeta() error = %v", err)
+			}
+			if !sameJSON(got, tt.want) {
+				t.Errorf("benchmarkMeta() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBenchmarkVars(t *testing.T) {
+	str := func(s string) *string { return &s }
+
+	tests := []struct {
+		name    string
+		meta    *string
+		want    map[string]string
+		wantErr bool
+	}{
+		{name: "no meta", meta: nil, want: map[string]string{}},
+		{name: "no vars", meta: str(`{"team":"realtime"}`), want: map[string]string{}},
+		{name: "not an object", meta: str(`"free-form"`), want: map[string]string{}},
+		{name: "vars", meta: str(`{"vars":{"rps":"100"}}`), want: map[string]string{"rps": "100"}},
+		{name: "not strings", meta: str(`{"vars":{"rps":100}}`), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := BenchmarkVars(tt.meta)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("BenchmarkVars() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				b, _ := json.Marshal(got)
+				t.Errorf("BenchmarkVars() = %s, want %v", b, tt.want)
+			}
+		})
+	}
+}
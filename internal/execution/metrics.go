@@ -0,0 +1,133 @@
+package execution
+
+import (
+	"github.com/pocketbase/dbx"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rs/zerolog/log"
+	"github.com/supabase/supabench/models"
+)
+
+// phaseBuckets range from a quick init to a long soak test, in seconds.
+var phaseBuckets = []float64{1, 5, 15, 30, 60, 120, 300, 600, 1200, 1800, 3600, 7200, 14400}
+
+var (
+	phaseDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "supabench_run_phase_duration_seconds",
+		Help:    "Duration of the phases of finished runs.",
+		Buckets: phaseBuckets,
+	}, []string{"benchmark_id", "phase"})
+	phaseErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "supabench_run_phase_errors_total",
+		Help: "Run phases that failed.",
+	}, []string{"benchmark_id", "phase"})
+	runOutcomes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "supabench_runs_total",
+		Help: "Runs by result: success, fail, timeout or cancelled.",
+	}, []string{"benchmark_id", "result"})
+)
+
+var (
+	queueDepthDesc = prometheus.NewDesc(
+		"supabench_queue_depth",
+		"Runs waiting in the queue.",
+		nil, nil,
+	)
+	runsDesc = prometheus.NewDesc(
+		"supabench_runs",
+		"Runs by benchmark and status.",
+		[]string{"benchmark_id", "status"}, nil,
+	)
+)
+
+// outcomeStatuses are the statuses that decide the result of a run. A run
+// is counted once, when it reaches one of them from the queue or the
+// executor; teardown failures are counted as phase errors.
+var outcomeStatuses = map[string]bool{
+	StatusSuccess:   true,
+	StatusFail:      true,
+	StatusTimeout:   true,
+	StatusCancelled: true,
+}
+
+var undecidedStatuses = map[string]bool{
+	"":                 true,
+	StatusPending:      true,
+	StatusProvisioning: true,
+	StatusRunning:      true,
+}
+
+func isOutcome(from, to string) bool {
+	return undecidedStatuses[from] && outcomeStatuses[to]
+}
+
+// Collector reads the queue and run counts from the database on every
+// scrape.
+func (app *App) Collector() prometheus.Collector {
+	return collector{app}
+}
+
+type collector struct {
+	app *App
+}
+
+func (c collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- queueDepthDesc
+	ch <- runsDesc
+}
+
+func (c collector) Collect(ch chan<- prometheus.Metric) {
+	var pending int
+	if err := c.app.PB.DB().
+		Select("count(*)").
+		From(models.Run{}.TableName()).
+		Where(dbx.HashExp{"status": StatusPending}).
+		Row(&pending); err != nil {
+		ch <- prometheus.NewInvalidMetric(queueDepthDesc, err)
+	} else {
+		ch <- prometheus.MustNewConstMetric(queueDepthDesc, prometheus.GaugeValue, float64(pending))
+	}
+
+	var counts []struct {
+		BenchmarkID string `db:"benchmark_id"`
+		Status      string `db:"status"`
+		Count       int    `db:"count"`
+	}
+	if err := c.app.PB.DB().
+		Select("benchmark_id", "status", "count(*) AS count").
+		From(models.Run{}.TableName()).
+		GroupBy("benchmark_id", "status").
+		All(&counts); err != nil {
+		ch <- prometheus.NewInvalidMetric(runsDesc, err)
+		return
+	}
+	for _, n := range counts {
+		ch <- prometheus.MustNewConstMetric(runsDesc, prometheus.GaugeValue, float64(n.Count), n.BenchmarkID, n.Status)
+	}
+}
+
+// countOutcome counts the result of a run when it is decided.
+func (app *App) countOutcome(runID, benchmarkID, from, to string) {
+	if !isOutcome(from, to) {
+		return
+	}
+	if benchmarkID == "" {
+		if err := app.PB.DB().
+			Select("benchmark_id").
+			From(models.Run{}.TableName()).
+			Where(dbx.HashExp{"id": runID}).
+			Row(&benchmarkID); err != nil {
+			log.Warn().Err(err).Str("run_id", runID).Msg("cannot find benchmark of run")
+		}
+	}
+	runOutcomes.WithLabelValues(benchmarkID, to).Inc()
+}
+
+// observePhases records the phase durations of a finished run.
+func observePhases(run models.Run) {
+	for _, p := range RunPhases(run) {
+		if d := p.Duration(); d > 0 {
+			phaseDuration.WithLabelValues(run.BenchmarkID, p.Name).Observe(d.Seconds())
+		}
+	}
+}
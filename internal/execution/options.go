@@ -0,0 +1,93 @@
+package execution
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/pocketbase/dbx"
+	"github.com/rs/zerolog/log"
+	"github.com/supabase/supabench/internal/terraform"
+	"github.com/supabase/supabench/models"
+)
+
+// execOptions returns the terraform options set in the "terraform" key of
+// the benchmark meta.
+func (app *App) execOptions(benchmarkID string) (terraform.ExecOptions, error) {
+	var benchmark models.Benchmark
+	if err := app.PB.DB().
+		Select().
+		Where(dbx.HashExp{"id": benchmarkID}).
+		One(&benchmark); err != nil {
+		return terraform.ExecOptions{}, err
+	}
+	return BenchmarkExecOptions(benchmark.Meta)
+}
+
+// destroyOptions is like execOptions, but falls back to the defaults, so
+// that resources can be destroyed even if the options were broken since.
+func (app *App) destroyOptions(benchmarkID string) terraform.ExecOptions {
+	opts, err := app.execOptions(benchmarkID)
+	if err != nil {
+		log.Warn().Err(err).Str("benchmark_id", benchmarkID).Msg("using default terraform options")
+		return terraform.ExecOptions{}
+	}
+	return opts
+}
+
+// baseVars returns the vars every run of the benchmark gets: the non-secret
+// vars of the benchmark meta overlaid with the secret vars.
+func (app *App) baseVars(benchmarkID string, secret *models.Secret) map[string]string {
+	vars := app.benchmarkVars(benchmarkID)
+	for k, v := range getVars(secret.Vars) {
+		vars[k] = v
+	}
+	return vars
+}
+
+// benchmarkVars returns the non-secret vars of the benchmark meta.
+func (app *App) benchmarkVars(benchmarkID string) map[string]string {
+	var benchmark models.Benchmark
+	if err := app.PB.DB().
+		Select().
+		Where(dbx.HashExp{"id": benchmarkID}).
+		One(&benchmark); err != nil {
+		log.Warn().Err(err).Str("benchmark_id", benchmarkID).Msg("cannot get benchmark vars")
+		return map[string]string{}
+	}
+	vars, err := BenchmarkVars(benchmark.Meta)
+	if err != nil {
+		log.Warn().Err(err).Str("benchmark_id", benchmarkID).Msg("cannot get benchmark vars")
+		return map[string]string{}
+	}
+	return vars
+}
+
+// BenchmarkVars parses the non-secret vars from the "vars" key of benchmark
+// meta. Unlike the secret vars they are not redacted.
+func BenchmarkVars(meta *string) (map[string]string, error) {
+	vars := map[string]string{}
+	if meta == nil || *meta == "" {
+		return vars, nil
+	}
+	m := map[string]json.RawMessage{}
+	if err := json.Unmarshal([]byte(*meta), &m); err != nil || m["vars"] == nil {
+		return vars, nil
+	}
+	if err := json.Unmarshal(m["vars"], &vars); err != nil {
+		return nil, errors.New("benchmark meta vars must be a map of strings")
+	}
+	return vars, nil
+}
+
+// BenchmarkExecOptions parses the terraform options from benchmark meta.
+func BenchmarkExecOptions(meta *string) (terraform.ExecOptions, error) {
+	if meta == nil || *meta == "" {
+		return terraform.ExecOptions{}, nil
+	}
+	m := map[string]json.RawMessage{}
+	if err := json.Unmarshal([]byte(*meta), &m); err != nil {
+		// meta is free-form, only the terraform key is validated
+		return terraform.ExecOptions{}, nil
+	}
+	return terraform.ParseExecOptions(m["terraform"])
+}
@@ -0,0 +1,123 @@
+package execution
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"text/template"
+
+	"github.com/pocketbase/dbx"
+	"github.com/rs/zerolog/log"
+	"github.com/supabase/supabench/internal/redact"
+	"github.com/supabase/supabench/models"
+)
+
+// saveOutputs reads the terraform outputs of the applied modules and stores
+// them on the run. Later modules win on name clashes and sensitive outputs
+// are masked.
+func (app *App) saveOutputs(run *models.Run, r *redact.Redactor, wds ...string) {
+	outputs := map[string]string{}
+	for _, wd := range wds {
+		out, err := app.TF.Outputs(context.Background(), wd)
+		if err != nil {
+			log.Warn().Err(r.Error(err)).Str("run_id", run.Id).Msg("cannot read terraform outputs")
+			continue
+		}
+		for name, o := range out {
+			if o.Sensitive {
+				outputs[name] = redact.Mask
+				continue
+			}
+			outputs[name] = r.String(o.Value)
+		}
+	}
+
+	b, err := json.Marshal(outputs)
+	if err != nil {
+		log.Error().Err(err).Msg("error marshalling run outputs")
+		return
+	}
+	s := string(b)
+	run.Outputs = &s
+	if err := app.PB.DB().Model(run).Update("Outputs"); err != nil {
+		log.Error().Err(err).Str("run_id", run.Id).Msg("error updating run outputs")
+	}
+}
+
+// RunOutputs returns the terraform outputs stored on the run.
+func RunOutputs(run models.Run) map[string]string {
+	outputs := map[string]string{}
+	if run.Outputs != nil && *run.Outputs != "" {
+		if err := json.Unmarshal([]byte(*run.Outputs), &outputs); err != nil {
+			log.Warn().Err(err).Str("run_id", run.Id).Msg("cannot parse run outputs")
+		}
+	}
+	return outputs
+}
+
+// TemplateData is what comment templates can refer to, e.g.
+// {{ .Outputs.sut_endpoint }}.
+type TemplateData struct {
+	ID      string
+	Name    string
+	Status  string
+	Origin  string
+	Vars    map[string]string
+	Outputs map[string]string
+}
+
+func templateData(run models.Run) TemplateData {
+	data := TemplateData{
+		ID:      run.Id,
+		Name:    run.Name,
+		Status:  run.Status,
+		Vars:    getVars(run.ResolvedVars),
+		Outputs: RunOutputs(run),
+	}
+	if run.Origin != nil {
+		data.Origin = *run.Origin
+	}
+	return data
+}
+
+// withTemplate appends the rendered comment template of the benchmark to a
+// message about the run, i.e. PR comments and alerts.
+func (app *App) withTemplate(run models.Run, msg string) string {
+	if extra := app.commentTemplate(run); extra != "" {
+		msg += "\n\n" + extra
+	}
+	return msg
+}
+
+// commentTemplate renders the comment_template from the benchmark meta for
+// the run. It is empty if the benchmark has no template.
+func (app *App) commentTemplate(run models.Run) string {
+	var benchmark models.Benchmark
+	if err := app.PB.DB().
+		Select().
+		Where(dbx.HashExp{"id": run.BenchmarkID}).
+		One(&benchmark); err != nil || benchmark.Meta == nil {
+		return ""
+	}
+
+	meta := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(*benchmark.Meta), &meta); err != nil {
+		return ""
+	}
+	text, ok := meta["comment_template"].(string)
+	if !ok || text == "" {
+		return ""
+	}
+
+	tmpl, err := template.New("comment").Option("missingkey=zero").Parse(text)
+	if err != nil {
+		log.Warn().Err(err).Str("benchmark_id", run.BenchmarkID).Msg("invalid comment template")
+		return ""
+	}
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, templateData(run)); err != nil {
+		log.Warn().Err(err).Str("benchmark_id", run.BenchmarkID).Msg("cannot render comment template")
+		return ""
+	}
+	return b.String()
+}
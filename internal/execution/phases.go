@@ -0,0 +1,187 @@
+package execution
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/tools/types"
+	"github.com/rs/zerolog/log"
+	"github.com/supabase/supabench/internal/gh"
+	"github.com/supabase/supabench/models"
+)
+
+// Run phases, in execution order.
+const (
+	PhaseUnpack    = "unpack"
+	PhaseInit      = "init"
+	PhasePlan      = "plan"
+	PhaseProvision = "provision"
+	PhaseLoad      = "load"
+	PhaseCollect   = "collect"
+	PhaseTeardown  = "teardown"
+)
+
+var phaseOrder = []string{PhaseUnpack, PhaseInit, PhasePlan, PhaseProvision, PhaseLoad, PhaseCollect, PhaseTeardown}
+
+// Phase is a step of the run lifecycle with its timings.
+type Phase struct {
+	Name      string         `json:"name"`
+	StartedAt types.DateTime `json:"started_at"`
+	EndedAt   types.DateTime `json:"ended_at"`
+	Error     string         `json:"error,omitempty"`
+}
+
+// Duration returns how long the phase took, or zero if it is not done.
+func (p Phase) Duration() time.Duration {
+	if p.StartedAt.IsZero() || p.EndedAt.IsZero() {
+		return 0
+	}
+	return p.EndedAt.Time().Sub(p.StartedAt.Time())
+}
+
+// RunPhases returns the phases recorded on the run in execution order.
+func RunPhases(run models.Run) []Phase {
+	phases := []Phase{}
+	if run.Phases == nil || *run.Phases == "" {
+		return phases
+	}
+	if err := json.Unmarshal([]byte(*run.Phases), &phases); err != nil {
+		log.Warn().Err(err).Str("run_id", run.Id).Msg("cannot parse run phases")
+	}
+	return phases
+}
+
+// phase runs fn as the named phase of the run, saving its timings and error.
+func (app *App) phase(run *models.Run, name string, fn func() error) error {
+	p := Phase{Name: name, StartedAt: types.NowDateTime()}
+	app.savePhase(run, p)
+
+	err := fn()
+	p.EndedAt = types.NowDateTime()
+	if err != nil {
+		p.Error = err.Error()
+		phaseErrors.WithLabelValues(run.BenchmarkID, name).Inc()
+	}
+	app.savePhase(run, p)
+	return err
+}
+
+// savePhase adds or replaces the phase on the run and saves it.
+func (app *App) savePhase(run *models.Run, p Phase) {
+	phases := RunPhases(*run)
+	replaced := false
+	for i := range phases {
+		if phases[i].Name == p.Name {
+			phases[i] = p
+			replaced = true
+		}
+	}
+	if !replaced {
+		phases = append(phases, p)
+	}
+	sortPhases(phases)
+
+	b, err := json.Marshal(phases)
+	if err != nil {
+		log.Error().Err(err).Msg("error marshalling run phases")
+		return
+	}
+	s := string(b)
+	run.Phases = &s
+	if err := app.PB.DB().Model(run).Update("Phases"); err != nil {
+		log.Error().Err(err).Str("run_id", run.Id).Msg("error updating run phases")
+	}
+}
+
+func sortPhases(phases []Phase) {
+	rank := map[string]int{}
+	for i, name := range phaseOrder {
+		rank[name] = i
+	}
+	for i := 1; i < len(phases); i++ {
+		for j := i; j > 0 && rank[phases[j].Name] < rank[phases[j-1].Name]; j-- {
+			phases[j], phases[j-1] = phases[j-1], phases[j]
+		}
+	}
+}
+
+// splitApply splits the terraform apply into provision, load and collect
+// phases using the window the loader generated load in, reported in
+// load_started_at and load_ended_at. Without a usable window the whole
+// apply stays provisioning.
+func (app *App) splitApply(run *models.Run) {
+	var apply Phase
+	for _, p := range RunPhases(*run) {
+		if p.Name == PhaseProvision {
+			apply = p
+		}
+	}
+	if apply.EndedAt.IsZero() {
+		return
+	}
+
+	loadStart, ok1 := millisToDateTime(run.LoadStartedAt)
+	loadEnd, ok2 := millisToDateTime(run.LoadEndedAt)
+	if !ok1 || !ok2 ||
+		loadEnd.Time().Before(loadStart.Time()) ||
+		!loadStart.Time().Before(apply.EndedAt.Time()) ||
+		!loadEnd.Time().After(apply.StartedAt.Time()) {
+		return
+	}
+	// the loader clock may be off a little, the load happens during apply
+	if loadStart.Time().Before(apply.StartedAt.Time()) {
+		loadStart = apply.StartedAt
+	}
+	if loadEnd.Time().After(apply.EndedAt.Time()) {
+		loadEnd = apply.EndedAt
+	}
+
+	app.savePhase(run, Phase{Name: PhaseProvision, StartedAt: apply.StartedAt, EndedAt: loadStart})
+	app.savePhase(run, Phase{Name: PhaseLoad, StartedAt: loadStart, EndedAt: loadEnd})
+	app.savePhase(run, Phase{Name: PhaseCollect, StartedAt: loadEnd, EndedAt: apply.EndedAt, Error: apply.Error})
+}
+
+// reloadRun refreshes the run with what the loader reported through the
+// collection API while terraform was running.
+func (app *App) reloadRun(run *models.Run) {
+	if err := app.PB.DB().
+		Select().
+		Where(dbx.HashExp{"id": run.Id}).
+		One(run); err != nil {
+		log.Warn().Err(err).Str("run_id", run.Id).Msg("cannot reload run")
+	}
+}
+
+func millisToDateTime(ms *string) (types.DateTime, bool) {
+	if ms == nil {
+		return types.DateTime{}, false
+	}
+	n, err := strconv.ParseInt(*ms, 10, 64)
+	if err != nil || n <= 0 {
+		return types.DateTime{}, false
+	}
+	dt, err := types.ParseDateTime(time.UnixMilli(n).UTC())
+	if err != nil {
+		return types.DateTime{}, false
+	}
+	return dt, true
+}
+
+// phaseTimings renders the run phases for a PR comment.
+func phaseTimings(run models.Run) string {
+	timings := []gh.PhaseTiming{}
+	for _, p := range RunPhases(run) {
+		timings = append(timings, gh.PhaseTiming{Name: p.Name, Duration: p.Duration(), Failed: p.Error != ""})
+	}
+	return gh.PhaseTimingsString(timings)
+}
+
+// withTimings appends the run phase timings to a PR comment.
+func withTimings(comment string, run models.Run) string {
+	if timings := phaseTimings(run); timings != "" {
+		return comment + "\n\n" + timings
+	}
+	return comment
+}
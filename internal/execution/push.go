@@ -0,0 +1,164 @@
+package execution
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/tools/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+	"github.com/supabase/supabench/internal/metrics"
+	"github.com/supabase/supabench/internal/summary"
+	"github.com/supabase/supabench/models"
+)
+
+// summaryMeasurement names the pushed summary metrics, e.g.
+// k6_summary_http_req_duration_p_95 once VictoriaMetrics stored them.
+const summaryMeasurement = "k6_summary"
+
+var pushErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "supabench_metrics_push_errors_total",
+	Help: "Run summaries that could not be pushed.",
+}, []string{"benchmark_id"})
+
+// summaryRetryWindow is how long after a run finished a failed summary push
+// is retried.
+const summaryRetryWindow = 24 * time.Hour
+
+// pushing holds the ids of runs whose summary is being pushed, so that the
+// retry does not push a summary twice.
+var pushing sync.Map
+
+// pushSummary writes the k6 summary metrics of a finished run to
+// SUPABENCH_METRICS_PUSH_URL, so dashboards show the run even if its loader
+// did not push metrics itself. Runs are marked with summary_pushed_at once
+// there is nothing left to push.
+func (app *App) pushSummary(run models.Run) {
+	url := viper.GetString("METRICS_PUSH_URL")
+	if url == "" {
+		return
+	}
+	if _, busy := pushing.LoadOrStore(run.Id, true); busy {
+		return
+	}
+	defer pushing.Delete(run.Id)
+	logger := log.With().Str("benchmark_id", run.BenchmarkID).Str("run_id", run.Id).Logger()
+
+	if run.Raw != nil && *run.Raw != "" {
+		point, err := app.summaryPoint(run)
+		if err != nil {
+			logger.Error().Err(err).Msg("error reading run summary")
+			pushErrors.WithLabelValues(run.BenchmarkID).Inc()
+			return
+		}
+		if len(point.Fields) > 0 {
+			if err := push(url, point); err != nil {
+				logger.Error().Err(err).Msg("error pushing run summary")
+				pushErrors.WithLabelValues(run.BenchmarkID).Inc()
+				return
+			}
+			logger.Info().Int("metrics", len(point.Fields)).Msg("pushed run summary")
+		}
+	}
+
+	run.SummaryPushedAt = types.NowDateTime()
+	if err := app.PB.DB().Model(&run).Update("SummaryPushedAt"); err != nil {
+		logger.Error().Err(err).Msg("error marking run summary as pushed")
+	}
+}
+
+func push(url string, point metrics.Point) error {
+	pusher, err := metrics.NewPusher(url, viper.GetString("METRICS_PUSH_FORMAT"))
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	return pusher.Push(ctx, point)
+}
+
+// retrySummaryPushes pushes the summaries of runs that finished recently
+// but were not pushed, e.g. because the endpoint was down. The pushes run
+// in the background and do not hold up the scheduler.
+func (app *App) retrySummaryPushes() {
+	if app.PB.DB() == nil || viper.GetString("METRICS_PUSH_URL") == "" {
+		return
+	}
+
+	since, _ := types.ParseDateTime(time.Now().UTC().Add(-summaryRetryWindow))
+	var runs []models.Run
+	if err := app.PB.DB().
+		Select().
+		Where(dbx.HashExp{"status": StatusFinished, "summary_pushed_at": ""}).
+		AndWhere(dbx.NewExp("finished_at >= {:since}", dbx.Params{"since": since.String()})).
+		OrderBy("finished_at").
+		All(&runs); err != nil {
+		log.Error().Err(err).Msg("error finding runs with unpushed summaries")
+		return
+	}
+
+	for _, run := range runs {
+		go app.pushSummary(run)
+	}
+}
+
+// summaryPoint turns the run summary into a point tagged like the metrics
+// loaders push, with the run name as testrun. The benchmark key metric is
+// added as key_metric.
+func (app *App) summaryPoint(run models.Run) (metrics.Point, error) {
+	var benchmark models.Benchmark
+	if err := app.PB.DB().
+		Select().
+		Where(dbx.HashExp{"id": run.BenchmarkID}).
+		One(&benchmark); err != nil {
+		return metrics.Point{}, err
+	}
+
+	raw := []byte(*run.Raw)
+	fields := map[string]float64{}
+	for name, v := range summary.Values(raw) {
+		fields[metrics.SanitizeName(name)] = v
+	}
+	if benchmark.ExtractMetricPath != nil && *benchmark.ExtractMetricPath != "" {
+		if v, err := summary.Lookup(raw, *benchmark.ExtractMetricPath); err == nil {
+			fields["key_metric"] = v
+		}
+	}
+
+	tags := map[string]string{
+		"benchmark":    benchmark.Name,
+		"benchmark_id": benchmark.Id,
+		"testrun":      run.Name,
+	}
+	if run.Origin != nil {
+		tags["origin"] = *run.Origin
+	}
+	vars, err := ParseVars(run.Vars)
+	if err != nil {
+		return metrics.Point{}, err
+	}
+	for k, v := range vars {
+		tags["var_"+metrics.SanitizeName(k)] = v
+	}
+
+	// the summary belongs to the end of the load, next to what the loader
+	// pushed while it ran
+	at := time.Now().UTC()
+	if ended, ok := millisToDateTime(run.LoadEndedAt); ok {
+		at = ended.Time()
+	} else if !run.FinishedAt.IsZero() {
+		// so that retried pushes are stamped like the first attempt
+		at = run.FinishedAt.Time()
+	}
+
+	return metrics.Point{
+		Name:   summaryMeasurement,
+		Tags:   tags,
+		Fields: fields,
+		Time:   at,
+	}, nil
+}
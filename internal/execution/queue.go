@@ -0,0 +1,310 @@
+package execution
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/tools/types"
+	"github.com/spf13/viper"
+	"github.com/supabase/supabench/models"
+)
+
+// durationSamples is the number of finished runs used to estimate how long a
+// benchmark takes.
+const durationSamples = 10
+
+var ErrNotQueued = errors.New("run is not queued")
+
+// QueueEntry is a pending run with its place in the queue.
+type QueueEntry struct {
+	Position          int            `json:"position"`
+	RunID             string         `json:"run_id"`
+	BenchmarkID       string         `json:"benchmark_id"`
+	Name              string         `json:"name"`
+	Priority          int            `json:"priority"`
+	TriggeredAt       types.DateTime `json:"triggered_at"`
+	EstimatedStart    time.Time      `json:"estimated_start"`
+	EstimatedDuration float64        `json:"estimated_duration_seconds"`
+}
+
+// Queue returns the pending runs in execution order together with their
+// estimated start times.
+func (app *App) Queue() ([]QueueEntry, error) {
+	runs, err := app.findRunsByStatus(StatusPending)
+	if err != nil {
+		return nil, err
+	}
+
+	durations := map[string]time.Duration{}
+	estimate := func(benchmarkID string) time.Duration {
+		if d, ok := durations[benchmarkID]; ok {
+			return d
+		}
+		d := app.estimateDuration(benchmarkID)
+		durations[benchmarkID] = d
+		return d
+	}
+
+	// the queue starts moving once the current run is done
+	now := time.Now().UTC()
+	start := now
+	active, err := app.findRunsByStatus(activeStatuses...)
+	if err != nil {
+		return nil, err
+	}
+	for _, run := range active {
+		if run.ExecutedAt.IsZero() {
+			continue
+		}
+		if end := run.ExecutedAt.Time().Add(estimate(run.BenchmarkID)); end.After(start) {
+			start = end
+		}
+	}
+
+	return queueEntries(runs, start, estimate), nil
+}
+
+// queueEntries lays out the pending runs, in execution order, one after
+// another from start.
+func queueEntries(runs []models.Run, start time.Time, estimate func(benchmarkID string) time.Duration) []QueueEntry {
+	queue := make([]QueueEntry, 0, len(runs))
+	for i, run := range runs {
+		d := estimate(run.BenchmarkID)
+		queue = append(queue, QueueEntry{
+			Position:          i + 1,
+			RunID:             run.Id,
+			BenchmarkID:       run.BenchmarkID,
+			Name:              run.Name,
+			Priority:          run.Priority,
+			TriggeredAt:       run.TriggeredAt,
+			EstimatedStart:    start,
+			EstimatedDuration: d.Seconds(),
+		})
+		start = start.Add(d)
+	}
+	return queue
+}
+
+// BumpRun moves a pending run to the front of the queue.
+func (app *App) BumpRun(id string) error {
+	return app.ReorderQueue([]string{id})
+}
+
+// ReorderQueue moves the given pending runs to the front of the queue, in
+// the given order. Other runs keep their relative order.
+func (app *App) ReorderQueue(ids []string) error {
+	runs, err := app.findRunsByStatus(StatusPending)
+	if err != nil {
+		return err
+	}
+	bumped, err := bumpPriorities(runs, ids)
+	if err != nil {
+		return err
+	}
+
+	return app.PB.DB().Transactional(func(tx *dbx.Tx) error {
+		for i := range bumped {
+			if err := tx.Model(&bumped[i]).Update("Priority"); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// bumpPriorities returns the given pending runs with priorities above all
+// others, descending in the given order.
+func bumpPriorities(pending []models.Run, ids []string) ([]models.Run, error) {
+	byID := map[string]models.Run{}
+	top := 0
+	for _, run := range pending {
+		byID[run.Id] = run
+		if run.Priority > top {
+			top = run.Priority
+		}
+	}
+
+	bumped := make([]models.Run, 0, len(ids))
+	for i, id := range ids {
+		run, ok := byID[id]
+		if !ok {
+			return nil, ErrNotQueued
+		}
+		run.Priority = top + len(ids) - i
+		bumped = append(bumped, run)
+	}
+	return bumped, nil
+}
+
+// SetRunPriority changes the priority of a pending run.
+func (app *App) SetRunPriority(id string, priority int) error {
+	run, err := app.findPendingRun(id)
+	if err != nil {
+		return err
+	}
+	run.Priority = priority
+	return app.PB.DB().Model(run).Update("Priority")
+}
+
+// DropRun removes a pending run from the queue. The run is kept as
+// cancelled.
+func (app *App) DropRun(id string) error {
+	run, err := app.findPendingRun(id)
+	if err != nil {
+		return err
+	}
+	run.FinishedAt = types.NowDateTime()
+	return app.Transition(run, StatusCancelled, SourceAPI, "dropped from the queue", "FinishedAt")
+}
+
+var ErrNotCancellable = errors.New("run is done executing and can no longer be cancelled")
+
+// errRunCancelled interrupts the run the scheduler executes.
+var errRunCancelled = errors.New("run cancelled")
+
+// CancelRun cancels a run. Pending runs are dropped from the queue,
+// executing runs are interrupted and then torn down by the scheduler. Runs
+// that are done executing are left alone.
+func (app *App) CancelRun(id string) (*models.Run, error) {
+	var run models.Run
+	if err := app.PB.DB().
+		Select().
+		Where(dbx.HashExp{"id": id}).
+		One(&run); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrRunNotFound
+		}
+		return nil, err
+	}
+
+	switch run.Status {
+	case StatusPending:
+		run.FinishedAt = types.NowDateTime()
+		if err := app.Transition(&run, StatusCancelled, SourceAPI, "cancelled", "FinishedAt"); err != nil {
+			return nil, err
+		}
+	case StatusProvisioning, StatusRunning:
+		if app.interrupt(run.Id) {
+			return &run, nil
+		}
+		// not executed here, e.g. left over from a restart
+		if err := app.Transition(&run, StatusCancelled, SourceAPI, "cancelled"); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, ErrNotCancellable
+	}
+	return &run, nil
+}
+
+func (app *App) setExecuting(runID string, cancel context.CancelCauseFunc) {
+	app.execMu.Lock()
+	defer app.execMu.Unlock()
+	app.execRunID = runID
+	app.execCancel = cancel
+}
+
+// interrupt cancels the run if the scheduler executes it.
+func (app *App) interrupt(runID string) bool {
+	app.execMu.Lock()
+	defer app.execMu.Unlock()
+	if app.execRunID != runID || app.execCancel == nil {
+		return false
+	}
+	app.execCancel(errRunCancelled)
+	return true
+}
+
+func (app *App) findPendingRun(id string) (*models.Run, error) {
+	var run models.Run
+	if err := app.PB.DB().
+		Select().
+		Where(dbx.HashExp{"id": id, "status": StatusPending}).
+		One(&run); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNotQueued
+		}
+		return nil, err
+	}
+	return &run, nil
+}
+
+// estimateDuration returns the average time recent runs of the benchmark
+// spent from leaving the queue until they were torn down.
+func (app *App) estimateDuration(benchmarkID string) time.Duration {
+	var runs []models.Run
+	err := app.PB.DB().
+		Select().
+		Where(dbx.HashExp{"benchmark_id": benchmarkID, "status": StatusFinished}).
+		AndWhere(dbx.NewExp("executed_at != '' AND finished_at != ''")).
+		OrderBy("finished_at DESC").
+		Limit(durationSamples).
+		All(&runs)
+
+	var total time.Duration
+	n := 0
+	if err == nil {
+		for _, run := range runs {
+			if d := run.FinishedAt.Time().Sub(run.ExecutedAt.Time()); d > 0 {
+				total += d
+				n++
+			}
+		}
+	}
+	if n == 0 {
+		return defaultRunDuration()
+	}
+	return total / time.Duration(n)
+}
+
+// defaultRunDuration is used for benchmarks without history, overridable
+// with SUPABENCH_QUEUE_DEFAULT_DURATION.
+func defaultRunDuration() time.Duration {
+	if d := viper.GetDuration("QUEUE_DEFAULT_DURATION"); d > 0 {
+		return d
+	}
+	return 30 * time.Minute
+}
+
+// SupersedeRuns cancels the pending runs of the same benchmark and PR as
+// the given run and records the run as the one superseding them.
+func (app *App) SupersedeRuns(run models.Run, prLink string) ([]models.Run, error) {
+	var prID string
+	if err := app.PB.DB().
+		Select("id").
+		From("github_prs").
+		Where(dbx.HashExp{"pr_link": prLink}).
+		Row(&prID); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var runs []models.Run
+	if err := app.PB.DB().
+		Select().
+		Where(dbx.HashExp{
+			"benchmark_id": run.BenchmarkID,
+			"github_pr_id": prID,
+			"status":       StatusPending,
+		}).
+		AndWhere(dbx.Not(dbx.HashExp{"id": run.Id})).
+		OrderBy("triggered_at").
+		All(&runs); err != nil {
+		return nil, err
+	}
+
+	for i := range runs {
+		runs[i].SupersededBy = &run.Id
+		runs[i].FinishedAt = types.NowDateTime()
+		if err := app.Transition(&runs[i], StatusCancelled, SourceAPI, "superseded by "+run.Name, "SupersededBy", "FinishedAt"); err != nil {
+			return nil, err
+		}
+	}
+
+	return runs, nil
+}
@@ -0,0 +1,118 @@
+package execution
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/pocketbase/tools/types"
+	"github.com/supabase/supabench/models"
+)
+
+func queuedRun(t *testing.T, id string, priority int, triggeredAt string) models.Run {
+	t.Helper()
+	at, err := types.ParseDateTime(triggeredAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	run := models.Run{BenchmarkID: "b-" + id, Priority: priority, TriggeredAt: at}
+	run.Id = id
+	return run
+}
+
+// queueOrder sorts runs like the scheduler picks them.
+func queueOrder(runs []models.Run) []string {
+	sort.SliceStable(runs, func(i, j int) bool {
+		if runs[i].Priority != runs[j].Priority {
+			return runs[i].Priority > runs[j].Priority
+		}
+		return runs[i].TriggeredAt.Time().Before(runs[j].TriggeredAt.Time())
+	})
+	ids := make([]string, 0, len(runs))
+	for _, run := range runs {
+		ids = append(ids, run.Id)
+	}
+	return ids
+}
+
+func TestBumpPriorities(t *testing.T) {
+	pending := func() []models.Run {
+		return []models.Run{
+			queuedRun(t, "a", 0, "2026-10-19 10:00:00.000Z"),
+			queuedRun(t, "b", 0, "2026-10-19 10:01:00.000Z"),
+			queuedRun(t, "c", 5, "2026-10-19 10:02:00.000Z"),
+			queuedRun(t, "d", 0, "2026-10-19 10:03:00.000Z"),
+		}
+	}
+
+	tests := []struct {
+		name    string
+		ids     []string
+		want    []string
+		wantErr error
+	}{
+		{name: "unchanged", ids: nil, want: []string{"c", "a", "b", "d"}},
+		{name: "bump", ids: []string{"d"}, want: []string{"d", "c", "a", "b"}},
+		{name: "bump the first", ids: []string{"c"}, want: []string{"c", "a", "b", "d"}},
+		{name: "reorder", ids: []string{"b", "d", "c"}, want: []string{"b", "d", "c", "a"}},
+		{name: "not queued", ids: []string{"a", "x"}, wantErr: ErrNotQueued},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runs := pending()
+			bumped, err := bumpPriorities(runs, tt.ids)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("bumpPriorities() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			for _, b := range bumped {
+				for i := range runs {
+					if runs[i].Id == b.Id {
+						runs[i] = b
+					}
+				}
+			}
+			if got := queueOrder(runs); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("queue after bumpPriorities() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueueEntries(t *testing.T) {
+	start := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+	runs := []models.Run{
+		queuedRun(t, "a", 1, "2026-10-19 09:00:00.000Z"),
+		queuedRun(t, "b", 0, "2026-10-19 09:01:00.000Z"),
+		queuedRun(t, "c", 0, "2026-10-19 09:02:00.000Z"),
+	}
+	durations := map[string]time.Duration{"b-a": 10 * time.Minute, "b-b": time.Hour, "b-c": 0}
+
+	queue := queueEntries(runs, start, func(benchmarkID string) time.Duration {
+		return durations[benchmarkID]
+	})
+
+	want := []struct {
+		position int
+		start    time.Time
+		seconds  float64
+	}{
+		{position: 1, start: start, seconds: 600},
+		{position: 2, start: start.Add(10 * time.Minute), seconds: 3600},
+		{position: 3, start: start.Add(70 * time.Minute), seconds: 0},
+	}
+	if len(queue) != len(want) {
+		t.Fatalf("queueEntries() returned %d entries, want %d", len(queue), len(want))
+	}
+	for i, w := range want {
+		e := queue[i]
+		if e.RunID != runs[i].Id || e.Position != w.position || !e.EstimatedStart.Equal(w.start) || e.EstimatedDuration != w.seconds {
+			t.Errorf("entry %d = %+v, want position %d starting %s for %vs", i, e, w.position, w.start, w.seconds)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package execution
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/pocketbase/dbx"
+	"github.com/rs/zerolog/log"
+	"github.com/supabase/supabench/internal/redact"
+	"github.com/supabase/supabench/models"
+)
+
+// RedactorFor returns a redactor that knows every secret value injected into
+// runs of the given benchmark: secret env and vars plus supabench's own
+// credentials.
+func (app *App) RedactorFor(benchmarkID string) (*redact.Redactor, error) {
+	secret, err := app.findSecret(benchmarkID)
+	if err != nil {
+		return redact.New(app.TF.Secrets()...), err
+	}
+	return newRedactor(app, secret), nil
+}
+
+func newRedactor(app *App, secret *models.Secret) *redact.Redactor {
+	r := redact.New(app.TF.Secrets()...)
+	r.AddMap(getEnvs(secret.Env))
+	r.AddMap(getVars(secret.Vars))
+	return r
+}
+
+// comment adds the benchmark comment template, redacts the comment and
+// pushes it to the PR.
+func (app *App) comment(run models.Run, prLink string, comment string) {
+	r, err := app.RedactorFor(run.BenchmarkID)
+	if err != nil {
+		log.Warn().Err(err).Str("run_id", run.Id).Msg("cannot get secrets to redact comment")
+	}
+	if _, err := app.GH.AddOrUpdateComment(context.TODO(), prLink, r.String(app.withTemplate(run, comment))); err != nil {
+		log.Error().Err(r.Error(err)).Str("run_id", run.Id).Msg("error updating PR comment")
+	}
+}
+
+// alertRun adds the benchmark comment template to an alert about the run,
+// redacts it and sends it.
+func (app *App) alertRun(runID, msg string) {
+	var run models.Run
+	if err := app.PB.DB().
+		Select().
+		Where(dbx.HashExp{"id": runID}).
+		One(&run); err != nil {
+		// the run may be gone, the alert is still worth sending
+		app.alert(msg)
+		return
+	}
+
+	r, err := app.RedactorFor(run.BenchmarkID)
+	if err != nil {
+		log.Warn().Err(err).Str("run_id", run.Id).Msg("cannot get secrets to redact alert")
+	}
+	app.alert(r.String(app.withTemplate(run, msg)))
+}
+
+// recordError appends the error to the run errors and saves it. Errors
+// coming from runBenchmark and teardownBenchmark are already redacted.
+func (app *App) recordError(run *models.Run, err error) {
+	errs := []string{}
+	if run.Errors != nil && *run.Errors != "" {
+		if uerr := json.Unmarshal([]byte(*run.Errors), &errs); uerr != nil {
+			errs = []string{*run.Errors}
+		}
+	}
+	errs = append(errs, err.Error())
+
+	b, merr := json.Marshal(errs)
+	if merr != nil {
+		log.Error().Err(merr).Msg("error marshalling run errors")
+		return
+	}
+	runErrors := string(b)
+	run.Errors = &runErrors
+	if uerr := app.PB.DB().Model(run).Update("Errors"); uerr != nil {
+		log.Error().Err(uerr).Msg("error updating run errors")
+	}
+}
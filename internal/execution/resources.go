@@ -0,0 +1,260 @@
+package execution
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/tools/types"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+	"github.com/supabase/supabench/models"
+)
+
+// Kinds of tracked terraform working directories.
+const (
+	ResourceRun         = "run"
+	ResourceEnvironment = "environment"
+)
+
+// Statuses of tracked terraform working directories.
+const (
+	ResourceProvisioned = "provisioned"
+	ResourceLeaked      = "leaked"
+	ResourceDestroyed   = "destroyed"
+)
+
+// leakedRuns selects runs whose teardown failed and is retried by the
+// reaper instead of the scheduler.
+var leakedRuns = dbx.NewExp(
+	"id NOT IN (SELECT run_id FROM resources WHERE kind = {:kind} AND status = {:status})",
+	dbx.Params{"kind": ResourceRun, "status": ResourceLeaked},
+)
+
+// ListResources returns the working directories that may still hold
+// provisioned resources, oldest first.
+func (app *App) ListResources() ([]models.Resource, error) {
+	resources := []models.Resource{}
+	if err := app.PB.DB().
+		Select().
+		Where(dbx.Not(dbx.HashExp{"status": ResourceDestroyed})).
+		OrderBy("created").
+		All(&resources); err != nil {
+		return nil, err
+	}
+	return resources, nil
+}
+
+// trackResources records that terraform is about to provision resources in
+// wd for the run.
+func (app *App) trackResources(run *models.Run, kind, wd, environmentID string) *models.Resource {
+	res, err := app.findResource(run.Id, kind)
+	if err != nil {
+		log.Error().Err(err).Str("run_id", run.Id).Msg("error finding tracked resources")
+	}
+	if res != nil {
+		return res
+	}
+
+	res = &models.Resource{
+		RunID:       run.Id,
+		BenchmarkID: run.BenchmarkID,
+		Kind:        kind,
+		WorkingDir:  wd,
+		Status:      ResourceProvisioned,
+	}
+	if environmentID != "" {
+		res.EnvironmentID = &environmentID
+	}
+	res.RefreshId()
+	res.RefreshCreated()
+	res.RefreshUpdated()
+	if err := app.PB.DB().Model(res).Insert(); err != nil {
+		log.Error().Err(err).Str("run_id", run.Id).Msg("error tracking resources")
+	}
+	return res
+}
+
+// refreshResources reads the addresses of the resources terraform created.
+func (app *App) refreshResources(res *models.Resource) {
+	addresses, err := app.TF.StateResources(context.Background(), res.WorkingDir)
+	if err != nil {
+		log.Warn().Err(err).Str("wd", res.WorkingDir).Msg("cannot read terraform state")
+		return
+	}
+	b, err := json.Marshal(addresses)
+	if err != nil {
+		return
+	}
+	s := string(b)
+	res.Addresses = &s
+	res.RefreshUpdated()
+	if err := app.PB.DB().Model(res).Update("Addresses", "Updated"); err != nil {
+		log.Error().Err(err).Str("resource_id", res.Id).Msg("error updating tracked resources")
+	}
+}
+
+// releaseResources marks the resources of the run as destroyed.
+func (app *App) releaseResources(runID, kind string) {
+	res, err := app.findResource(runID, kind)
+	if err != nil || res == nil {
+		return
+	}
+
+	empty := "[]"
+	res.Status = ResourceDestroyed
+	res.Addresses = &empty
+	res.DestroyedAt = types.NowDateTime()
+	res.RefreshUpdated()
+	if err := app.PB.DB().Model(res).Update("Status", "Addresses", "DestroyedAt", "Updated"); err != nil {
+		log.Error().Err(err).Str("resource_id", res.Id).Msg("error releasing tracked resources")
+	}
+}
+
+// leakResources hands the resources of the run over to the reaper, which
+// retries the destroy with backoff.
+func (app *App) leakResources(runID, kind string, destroyErr error) {
+	res, err := app.findResource(runID, kind)
+	if err != nil || res == nil {
+		return
+	}
+
+	msg := destroyErr.Error()
+	res.Status = ResourceLeaked
+	res.Attempts++
+	res.LastError = &msg
+	res.NextAttemptAt, _ = types.ParseDateTime(time.Now().UTC().Add(reapBackoff(res.Attempts)))
+	res.RefreshUpdated()
+	if err := app.PB.DB().Model(res).
+		Update("Status", "Attempts", "LastError", "NextAttemptAt", "Updated"); err != nil {
+		log.Error().Err(err).Str("resource_id", res.Id).Msg("error updating tracked resources")
+	}
+}
+
+func (app *App) findResource(runID, kind string) (*models.Resource, error) {
+	var res models.Resource
+	if err := app.PB.DB().
+		Select().
+		Where(dbx.HashExp{"run_id": runID, "kind": kind}).
+		AndWhere(dbx.Not(dbx.HashExp{"status": ResourceDestroyed})).
+		One(&res); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &res, nil
+}
+
+// reapBackoff doubles the delay between destroy attempts, up to an hour.
+func reapBackoff(attempts int) time.Duration {
+	d := time.Minute
+	for i := 1; i < attempts && d < time.Hour; i++ {
+		d *= 2
+	}
+	if d > time.Hour {
+		d = time.Hour
+	}
+	return d
+}
+
+// resourceAlertAfter is how long resources may stay provisioned before an
+// alert is raised, configured with SUPABENCH_RESOURCE_ALERT_AFTER.
+func resourceAlertAfter() time.Duration {
+	if d := viper.GetDuration("RESOURCE_ALERT_AFTER"); d > 0 {
+		return d
+	}
+	return 6 * time.Hour
+}
+
+// reapResources retries destroying leaked resources and alerts about
+// resources that outlived the threshold.
+func (app *App) reapResources() {
+	if app.PB.DB() == nil {
+		return
+	}
+
+	resources, err := app.ListResources()
+	if err != nil {
+		log.Error().Err(err).Msg("error listing tracked resources")
+		return
+	}
+
+	now := time.Now().UTC()
+	for i := range resources {
+		res := &resources[i]
+
+		if res.AlertedAt.IsZero() && now.Sub(res.Created.Time()) > resourceAlertAfter() {
+			app.alertRun(res.RunID, fmt.Sprintf(
+				"supabench resources of run %s (benchmark %s) are %s for %s: %s",
+				res.RunID, res.BenchmarkID, res.Status, now.Sub(res.Created.Time()).Round(time.Minute), res.WorkingDir))
+			res.AlertedAt = types.NowDateTime()
+			if err := app.PB.DB().Model(res).Update("AlertedAt"); err != nil {
+				log.Error().Err(err).Str("resource_id", res.Id).Msg("error updating tracked resources")
+			}
+		}
+
+		if res.Status != ResourceLeaked || res.NextAttemptAt.Time().After(now) {
+			continue
+		}
+		log.Info().
+			Str("run_id", res.RunID).
+			Str("kind", res.Kind).
+			Int("attempt", res.Attempts+1).
+			Msg("retrying destroy of leaked resources")
+
+		switch res.Kind {
+		case ResourceRun:
+			app.reapRun(res.RunID)
+		case ResourceEnvironment:
+			if res.EnvironmentID != nil {
+				app.reapEnvironment(*res.EnvironmentID)
+			}
+		}
+	}
+}
+
+func (app *App) reapRun(runID string) {
+	var run models.Run
+	if err := app.PB.DB().
+		Select().
+		Where(dbx.HashExp{"id": runID}).
+		One(&run); err != nil {
+		log.Error().Err(err).Str("run_id", runID).Msg("cannot find run of leaked resources")
+		return
+	}
+
+	if err := app.Transition(&run, StatusTearingDown, SourceReaper, "retrying teardown"); err != nil {
+		log.Error().Err(err).Str("run_id", runID).Msg("error updating run status to tearing down")
+		return
+	}
+	if err := app.teardownBenchmark(&run); err != nil {
+		log.Error().Err(err).Str("run_id", runID).Msg("error destroying leaked resources")
+		if err := app.Transition(&run, StatusFail, SourceReaper, err.Error()); err != nil {
+			log.Error().Err(err).Msg("error updating run status to failed")
+		}
+		return
+	}
+
+	run.FinishedAt = types.NowDateTime()
+	if err := app.Transition(&run, StatusFinished, SourceReaper, "leaked resources destroyed", "FinishedAt"); err != nil {
+		log.Error().Err(err).Msg("error updating run status to finished")
+	}
+}
+
+func (app *App) reapEnvironment(envID string) {
+	var env models.Environment
+	if err := app.PB.DB().
+		Select().
+		Where(dbx.HashExp{"id": envID}).
+		One(&env); err != nil {
+		log.Error().Err(err).Str("environment_id", envID).Msg("cannot find leaked environment")
+		return
+	}
+	if err := app.destroyEnvironment(&env); err != nil {
+		log.Error().Err(err).Str("environment_id", envID).Msg("error destroying leaked environment")
+	}
+}
@@ -0,0 +1,44 @@
+package execution
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestReapBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{attempts: 0, want: time.Minute},
+		{attempts: 1, want: time.Minute},
+		{attempts: 2, want: 2 * time.Minute},
+		{attempts: 3, want: 4 * time.Minute},
+		{attempts: 6, want: 32 * time.Minute},
+		{attempts: 7, want: time.Hour},
+		{attempts: 100, want: time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.attempts), func(t *testing.T) {
+			if got := reapBackoff(tt.attempts); got != tt.want {
+				t.Errorf("reapBackoff(%d) = %s, want %s", tt.attempts, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResourceAlertAfter(t *testing.T) {
+	defer viper.Set("RESOURCE_ALERT_AFTER", nil)
+
+	if got := resourceAlertAfter(); got != 6*time.Hour {
+		t.Errorf("resourceAlertAfter() = %s, want the 6h default", got)
+	}
+	viper.Set("RESOURCE_ALERT_AFTER", "90m")
+	if got := resourceAlertAfter(); got != 90*time.Minute {
+		t.Errorf("resourceAlertAfter() = %s, want 1h30m", got)
+	}
+}
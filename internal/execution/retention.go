@@ -0,0 +1,273 @@
+package execution
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/tools/types"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+	"github.com/supabase/supabench/internal/summary"
+	"github.com/supabase/supabench/models"
+)
+
+// retentionBatchSize is the number of runs compacted or deleted at once.
+const retentionBatchSize = 100
+
+// retentionTickLimit is the number of runs compacted and deleted per
+// retention pass, so that a large backlog does not hold up the scheduler.
+// The rest is left to the next passes.
+const retentionTickLimit = 500
+
+var ErrRunNotFound = errors.New("run not found")
+
+// RetentionPolicy limits how long runs of a benchmark are kept, in days.
+// Zero keeps them forever.
+type RetentionPolicy struct {
+	// RawDays is how long the full raw data is kept before it is compacted
+	// to the metrics.
+	RawDays int `json:"raw_days"`
+	// RunDays is how long runs are kept at all.
+	RunDays int `json:"run_days"`
+}
+
+// retentionPolicy returns the retention of a benchmark. The defaults are
+// set with SUPABENCH_RETENTION_RAW_DAYS and SUPABENCH_RETENTION_RUN_DAYS
+// and overridden by the "retention" key of the project meta and then of the
+// benchmark meta.
+func retentionPolicy(projectMeta, benchmarkMeta *string) RetentionPolicy {
+	p := RetentionPolicy{
+		RawDays: viper.GetInt("RETENTION_RAW_DAYS"),
+		RunDays: viper.GetInt("RETENTION_RUN_DAYS"),
+	}
+	for _, meta := range []*string{projectMeta, benchmarkMeta} {
+		if meta == nil || *meta == "" {
+			continue
+		}
+		var m struct {
+			Retention struct {
+				RawDays *int `json:"raw_days"`
+				RunDays *int `json:"run_days"`
+			} `json:"retention"`
+		}
+		if err := json.Unmarshal([]byte(*meta), &m); err != nil {
+			// meta is free-form, only the retention key is read
+			continue
+		}
+		if m.Retention.RawDays != nil {
+			p.RawDays = *m.Retention.RawDays
+		}
+		if m.Retention.RunDays != nil {
+			p.RunDays = *m.Retention.RunDays
+		}
+	}
+	return p
+}
+
+// applyRetention compacts and deletes the done runs of every benchmark
+// according to its retention, at most retentionTickLimit runs at a time.
+// Pinned runs are kept as they are.
+func (app *App) applyRetention() {
+	if app.PB.DB() == nil {
+		return
+	}
+
+	var projects []models.Project
+	if err := app.PB.DB().Select().All(&projects); err != nil {
+		log.Error().Err(err).Msg("error finding projects for retention")
+		return
+	}
+	projectMeta := map[string]*string{}
+	for _, p := range projects {
+		projectMeta[p.Id] = p.Meta
+	}
+
+	var benchmarks []models.Benchmark
+	if err := app.PB.DB().Select().All(&benchmarks); err != nil {
+		log.Error().Err(err).Msg("error finding benchmarks for retention")
+		return
+	}
+
+	limit := retentionTickLimit
+	for _, b := range benchmarks {
+		if limit <= 0 {
+			log.Info().Msg("retention limit reached, continuing with the next pass")
+			return
+		}
+		policy := retentionPolicy(projectMeta[b.ProjectID], b.Meta)
+		compacted, deleted := 0, 0
+		var err error
+		if policy.RunDays > 0 {
+			deleted, err = app.deleteRuns(b.Id, retentionCutoff(policy.RunDays), limit)
+			limit -= deleted
+			if err != nil {
+				log.Error().Err(err).Str("benchmark_id", b.Id).Msg("error deleting runs")
+			}
+		}
+		if policy.RawDays > 0 && limit > 0 {
+			compacted, err = app.compactRuns(b, retentionCutoff(policy.RawDays), limit)
+			limit -= compacted
+			if err != nil {
+				log.Error().Err(err).Str("benchmark_id", b.Id).Msg("error compacting runs")
+			}
+		}
+		if compacted > 0 || deleted > 0 {
+			log.Info().
+				Str("benchmark_id", b.Id).
+				Int("compacted", compacted).
+				Int("deleted", deleted).
+				Msg("applied retention")
+		}
+	}
+}
+
+func retentionCutoff(days int) types.DateTime {
+	cutoff, _ := types.ParseDateTime(time.Now().UTC().AddDate(0, 0, -days))
+	return cutoff
+}
+
+// retainedRuns selects the done, unpinned runs of a benchmark triggered
+// before the cutoff.
+func retainedRuns(benchmarkID string, cutoff types.DateTime) dbx.Expression {
+	return dbx.And(
+		dbx.HashExp{"benchmark_id": benchmarkID, "pinned": false},
+		dbx.In("status", doneStatuses...),
+		dbx.NewExp("triggered_at < {:cutoff}", dbx.Params{"cutoff": cutoff.String()}),
+	)
+}
+
+// compactRuns replaces the raw data of up to limit old runs with their
+// metrics and whatever the extract_metric_path of the benchmark points to.
+func (app *App) compactRuns(b models.Benchmark, cutoff types.DateTime, limit int) (int, error) {
+	paths := []string{}
+	if b.ExtractMetricPath != nil && *b.ExtractMetricPath != "" {
+		paths = append(paths, *b.ExtractMetricPath)
+	}
+
+	n := 0
+	for n < limit {
+		var runs []models.Run
+		if err := app.PB.DB().
+			Select().
+			Where(retainedRuns(b.Id, cutoff)).
+			AndWhere(dbx.NewExp("compacted_at = '' AND raw IS NOT NULL AND raw NOT IN ('', 'null')")).
+			Limit(int64(min(retentionBatchSize, limit-n))).
+			All(&runs); err != nil {
+			return n, err
+		}
+
+		for i := range runs {
+			run := &runs[i]
+			compact, err := summary.Compact([]byte(*run.Raw), paths...)
+			if err != nil {
+				// not a k6 summary, keep it as it is
+				log.Warn().Err(err).Str("run_id", run.Id).Msg("cannot compact raw data")
+			} else {
+				raw := string(compact)
+				run.Raw = &raw
+			}
+			run.CompactedAt = types.NowDateTime()
+			if err := app.PB.DB().Model(run).Update("Raw", "CompactedAt"); err != nil {
+				return n, err
+			}
+			n++
+		}
+
+		if len(runs) < retentionBatchSize {
+			return n, nil
+		}
+	}
+	return n, nil
+}
+
+// deleteRuns deletes up to limit old runs together with their history.
+// Runs that still hold resources or an environment are kept until those are
+// destroyed.
+func (app *App) deleteRuns(benchmarkID string, cutoff types.DateTime, limit int) (int, error) {
+	var ids []string
+	if err := app.PB.DB().
+		Select("id").
+		From(models.Run{}.TableName()).
+		Where(retainedRuns(benchmarkID, cutoff)).
+		AndWhere(dbx.NewExp(
+			"id NOT IN (SELECT run_id FROM resources WHERE status != {:destroyed})",
+			dbx.Params{"destroyed": ResourceDestroyed},
+		)).
+		AndWhere(dbx.NewExp(
+			"id NOT IN (SELECT run_id FROM environments WHERE status != {:env_destroyed})",
+			dbx.Params{"env_destroyed": EnvironmentDestroyed},
+		)).
+		Limit(int64(limit)).
+		Column(&ids); err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, batch := range batches(ids, retentionBatchSize) {
+		if err := app.deleteRunBatch(batch); err != nil {
+			return n, err
+		}
+		n += len(batch)
+	}
+	return n, nil
+}
+
+// batches splits ids into batches of at most size, so that every batch
+// stays below the bound variable limit of SQLite.
+func batches(ids []string, size int) [][]string {
+	var out [][]string
+	for len(ids) > 0 {
+		batch := ids[:min(size, len(ids))]
+		ids = ids[len(batch):]
+		out = append(out, batch)
+	}
+	return out
+}
+
+func (app *App) deleteRunBatch(ids []string) error {
+	in := make([]interface{}, len(ids))
+	for i, id := range ids {
+		in[i] = id
+	}
+	return app.PB.DB().Transactional(func(tx *dbx.Tx) error {
+		for table, column := range map[string]string{
+			models.RunEvent{}.TableName(): "run_id",
+			models.Resource{}.TableName(): "run_id",
+		} {
+			if _, err := tx.Delete(table, dbx.In(column, in...)).Execute(); err != nil {
+				return err
+			}
+		}
+		// reruns and superseded runs outlive the runs they refer to
+		for _, column := range []string{"source_run_id", "superseded_by"} {
+			if _, err := tx.Update(models.Run{}.TableName(), dbx.Params{column: nil}, dbx.In(column, in...)).Execute(); err != nil {
+				return err
+			}
+		}
+		_, err := tx.Delete(models.Run{}.TableName(), dbx.In("id", in...)).Execute()
+		return err
+	})
+}
+
+// PinRun keeps a run, e.g. a baseline, from being compacted or deleted by
+// retention.
+func (app *App) PinRun(id string, pinned bool) (*models.Run, error) {
+	var run models.Run
+	if err := app.PB.DB().
+		Select().
+		Where(dbx.HashExp{"id": id}).
+		One(&run); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrRunNotFound
+		}
+		return nil, err
+	}
+	run.Pinned = pinned
+	if err := app.PB.DB().Model(&run).Update("Pinned"); err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
@@ -0,0 +1,128 @@
+package execution
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/tools/types"
+	"github.com/spf13/viper"
+)
+
+func TestRetentionPolicy(t *testing.T) {
+	str := func(s string) *string { return &s }
+
+	tests := []struct {
+		name      string
+		rawDays   int
+		runDays   int
+		project   *string
+		benchmark *string
+		want      RetentionPolicy
+	}{
+		{name: "keep everything", want: RetentionPolicy{}},
+		{name: "defaults", rawDays: 30, runDays: 365, want: RetentionPolicy{RawDays: 30, RunDays: 365}},
+		{
+			name:    "project overrides defaults",
+			rawDays: 30, runDays: 365,
+			project: str(`{"retention":{"raw_days":7}}`),
+			want:    RetentionPolicy{RawDays: 7, RunDays: 365},
+		},
+		{
+			name:      "benchmark overrides project",
+			rawDays:   30,
+			project:   str(`{"retention":{"raw_days":7,"run_days":90}}`),
+			benchmark: str(`{"retention":{"run_days":0}}`),
+			want:      RetentionPolicy{RawDays: 7, RunDays: 0},
+		},
+		{
+			name:      "meta without retention",
+			rawDays:   30,
+			project:   str(`{"team":"realtime"}`),
+			benchmark: str(``),
+			want:      RetentionPolicy{RawDays: 30},
+		},
+		{
+			name:    "free-form meta",
+			runDays: 365,
+			project: str(`"not an object"`),
+			want:    RetentionPolicy{RunDays: 365},
+		},
+	}
+
+	defer viper.Set("RETENTION_RAW_DAYS", nil)
+	defer viper.Set("RETENTION_RUN_DAYS", nil)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("RETENTION_RAW_DAYS", tt.rawDays)
+			viper.Set("RETENTION_RUN_DAYS", tt.runDays)
+			if got := retentionPolicy(tt.project, tt.benchmark); got != tt.want {
+				t.Errorf("retentionPolicy() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBatches(t *testing.T) {
+	ids := func(n int) []string {
+		out := make([]string, n)
+		for i := range out {
+			out[i] = fmt.Sprint(i)
+		}
+		return out
+	}
+
+	tests := []struct {
+		n    int
+		want []int
+	}{
+		{n: 0, want: nil},
+		{n: 1, want: []int{1}},
+		{n: 100, want: []int{100}},
+		{n: 101, want: []int{100, 1}},
+		{n: 250, want: []int{100, 100, 50}},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.n), func(t *testing.T) {
+			var sizes []int
+			var all []string
+			for _, b := range batches(ids(tt.n), retentionBatchSize) {
+				sizes = append(sizes, len(b))
+				all = append(all, b...)
+			}
+			if !reflect.DeepEqual(sizes, tt.want) {
+				t.Errorf("batch sizes = %v, want %v", sizes, tt.want)
+			}
+			if len(all) != tt.n {
+				t.Errorf("batches hold %d ids, want %d", len(all), tt.n)
+			}
+		})
+	}
+}
+
+func TestRetainedRuns(t *testing.T) {
+	cutoff, _ := types.ParseDateTime("2026-10-01 00:00:00.000Z")
+	params := dbx.Params{}
+	sql := retainedRuns("b1", cutoff).Build(dbx.NewFromDB(nil, "sqlite3"), params)
+
+	for _, want := range []string{"`pinned`={:p", "`status` IN ({:p", "triggered_at < {:cutoff}"} {
+		if !strings.Contains(sql, want) {
+			t.Errorf("retainedRuns() = %s, want it to contain %s", sql, want)
+		}
+	}
+	got := map[interface{}]bool{}
+	for _, v := range params {
+		got[v] = true
+	}
+	for _, want := range []interface{}{"b1", false, StatusFinished, StatusCancelled, cutoff.String()} {
+		if !got[want] {
+			t.Errorf("retainedRuns() params = %v, want %v among them", params, want)
+		}
+	}
+	if got[StatusRunning] || got[StatusPending] {
+		t.Errorf("retainedRuns() params = %v, want only done statuses", params)
+	}
+}
@@ -4,19 +4,22 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
 
 	"github.com/pocketbase/dbx"
 	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
 	"github.com/supabase/supabench/internal/archive"
+	"github.com/supabase/supabench/internal/terraform"
 	"github.com/supabase/supabench/models"
 )
 
-func (app *App) runBenchmark(run *models.Run) error {
+func (app *App) runBenchmark(ctx context.Context, run *models.Run) error {
 	// unpack script
-	basePath, secret, err := app.getSecretPath(run)
+	basePath, secret, err := app.getSecretPath(run.BenchmarkID)
 	if err != nil {
 		return err
 	}
@@ -24,16 +27,30 @@ func (app *App) runBenchmark(run *models.Run) error {
 	if secret.Script == nil {
 		return errors.New("secret script is nil, link is not supported yet")
 	}
+	r := newRedactor(app, secret)
+	opts, err := app.execOptions(run.BenchmarkID)
+	if err != nil {
+		return err
+	}
 
-	scriptWD, err := unpack(basePath, secret)
+	version, packedPath, err := app.runScript(run, secret)
 	if err != nil {
 		return err
 	}
+	var scriptWD string
+	if err := app.phase(run, PhaseUnpack, func() error {
+		scriptWD, err = unpack(runDir(run.Id), packedPath)
+		return err
+	}); err != nil {
+		return err
+	}
 
 	// construct envs
 	envs := getEnvs(secret.Env)
-	vars := getVars(secret.Vars)
-	for k, v := range getVars(run.Vars) {
+	secretVars := getVars(secret.Vars)
+	runVars := getVars(run.Vars)
+	vars := app.baseVars(run.BenchmarkID, secret)
+	for k, v := range runVars {
 		vars[k] = v
 	}
 
@@ -45,21 +62,78 @@ func (app *App) runBenchmark(run *models.Run) error {
 		vars["test_origin"] = *run.Origin
 	}
 
-	// tf apply to run benchmark
-	return app.TF.Apply(scriptWD, envs, vars)
+	// record what exactly is executed
+	resolved, err := resolvedVars(vars, secretVars, runVars)
+	if err != nil {
+		return err
+	}
+	run.ScriptVersionID = &version.Id
+	run.ResolvedVars = &resolved
+	if err := app.PB.DB().Model(run).Update("ScriptVersionID", "ResolvedVars"); err != nil {
+		return err
+	}
+
+	if run.DryRun {
+		return app.planRun(ctx, run, scriptWD, version.Id, envs, vars, opts, r)
+	}
+	if isSplit(scriptWD) {
+		return app.runSplit(ctx, run, scriptWD, version.Id, envs, vars, secretVars, opts, r)
+	}
+
+	if err := app.phase(run, PhaseInit, func() error {
+		return r.Error(app.TF.Init(ctx, scriptWD, opts))
+	}); err != nil {
+		return err
+	}
+
+	// tf apply to run benchmark, the loader reports back while it runs
+	res := app.trackResources(run, ResourceRun, scriptWD, "")
+	err = app.phase(run, PhaseProvision, func() error {
+		return r.Error(app.TF.Apply(ctx, scriptWD, envs, vars, opts, r))
+	})
+	app.refreshResources(res)
+	app.saveOutputs(run, r, scriptWD)
+	app.reloadRun(run)
+	app.splitApply(run)
+	return err
 }
 
+// teardownBenchmark destroys the run resources. If that fails, they are
+// left to the resource reaper.
 func (app *App) teardownBenchmark(run *models.Run) error {
+	if err := app.destroyRun(run); err != nil {
+		app.leakResources(run.Id, ResourceRun, err)
+		return err
+	}
+	app.releaseResources(run.Id, ResourceRun)
+	return nil
+}
+
+func (app *App) destroyRun(run *models.Run) error {
 	// unpack script
-	basePath, secret, err := app.getSecretPath(run)
+	basePath, secret, err := app.getSecretPath(run.BenchmarkID)
 	if err != nil {
 		return err
 	}
-	scriptWD := path.Join(basePath, "script_unpacked")
+	scriptWD := runDir(run.Id)
+	if run.DryRun {
+		// dry runs only plan, there is no state
+		return os.RemoveAll(scriptWD)
+	}
+	if _, err := os.Stat(scriptWD); os.IsNotExist(err) {
+		// runs started before state was kept per run
+		scriptWD = path.Join(basePath, "script_unpacked")
+	}
+	if _, err := os.Stat(scriptWD); os.IsNotExist(err) {
+		log.Warn().Str("run_id", run.Id).Msg("run has no working dir, nothing to destroy")
+		return nil
+	}
+
+	r := newRedactor(app, secret)
 
 	// construct envs
 	envs := getEnvs(secret.Env)
-	vars := getVars(secret.Vars)
+	vars := app.baseVars(run.BenchmarkID, secret)
 	for k, v := range getVars(run.Vars) {
 		vars[k] = v
 	}
@@ -70,18 +144,30 @@ func (app *App) teardownBenchmark(run *models.Run) error {
 		vars["test_origin"] = *run.Origin
 	}
 
-	// tf apply to run benchmark
-	err = app.TF.Destroy(scriptWD, envs, vars)
-	if err != nil {
+	if run.EnvironmentID != nil && *run.EnvironmentID != "" &&
+		terraform.IsModuleDir(path.Join(scriptWD, loadModule)) {
+		if err := app.teardownSplit(run, scriptWD, envs, vars, r); err != nil {
+			return err
+		}
+		if err = os.RemoveAll(scriptWD); err != nil {
+			log.Warn().Err(err).Msg("cannot remove run working dir")
+		}
+		return nil
+	}
+
+	// tf destroy to release benchmark resources
+	if err := app.phase(run, PhaseTeardown, func() error {
+		return r.Error(app.TF.Destroy(scriptWD, envs, vars, app.destroyOptions(run.BenchmarkID), r))
+	}); err != nil {
 		return err
 	}
 	if err = os.RemoveAll(scriptWD); err != nil {
-		log.Warn().Err(err).Msg("cannot remove script unpacked dir")
+		log.Warn().Err(err).Msg("cannot remove run working dir")
 	}
 	return nil
 }
 
-func (app *App) getSecretPath(run *models.Run) (string, *models.Secret, error) {
+func (app *App) getSecretPath(benchmarkID string) (string, *models.Secret, error) {
 	// we need secrets collection id to get path to benchmark script
 	secrets, err := app.PB.Dao().FindCollectionByNameOrId("secrets")
 	if err != nil {
@@ -89,10 +175,25 @@ func (app *App) getSecretPath(run *models.Run) (string, *models.Secret, error) {
 	}
 
 	// also get benchmark's secrets: id, script, envs
+	secret, err := app.findSecret(benchmarkID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	basePath := path.Join("pb_data/storage", secrets.Id, secret.Id)
+	return basePath, secret, nil
+}
+
+func (app *App) getSecretByID(id string) (string, *models.Secret, error) {
+	secrets, err := app.PB.Dao().FindCollectionByNameOrId("secrets")
+	if err != nil {
+		return "", nil, err
+	}
+
 	var secret models.Secret
 	if err := app.PB.DB().
 		Select().
-		Where(dbx.HashExp{"benchmark_id": run.BenchmarkID}).
+		Where(dbx.HashExp{"id": id}).
 		One(&secret); err != nil {
 		return "", nil, err
 	}
@@ -101,6 +202,17 @@ func (app *App) getSecretPath(run *models.Run) (string, *models.Secret, error) {
 	return basePath, &secret, nil
 }
 
+func (app *App) findSecret(benchmarkID string) (*models.Secret, error) {
+	var secret models.Secret
+	if err := app.PB.DB().
+		Select().
+		Where(dbx.HashExp{"benchmark_id": benchmarkID}).
+		One(&secret); err != nil {
+		return nil, err
+	}
+	return &secret, nil
+}
+
 func getEnvs(e *string) map[string]string {
 	envs := map[string]string{}
 	if e != nil {
@@ -135,45 +247,71 @@ func getVars(v *string) map[string]string {
 	return vars
 }
 
-func unpack(basePath string, secret *models.Secret) (string, error) {
-	packedPath := path.Join(basePath, *secret.Script)
-	// clear if exist already
-	scriptWD := path.Join(basePath, "script_unpacked")
-	scriptTemp := path.Join(basePath, "script_temp")
-	if err := os.RemoveAll(scriptTemp); err != nil {
+// unpack extracts the script into scriptWD, replacing what is there.
+func unpack(scriptWD string, packedPath string) (string, error) {
+	scriptTemp := scriptWD + ".tmp"
+	if err := os.RemoveAll(scriptWD); err != nil {
 		return "", err
 	}
-	if err := os.RemoveAll(scriptWD); err != nil {
+	if err := os.MkdirAll(path.Dir(scriptWD), 0755); err != nil {
 		return "", err
 	}
 	log.Info().Str("wd", scriptWD).Msg("unpacking script")
 
+	if err := extract(packedPath, scriptTemp, scriptWD); err != nil {
+		return "", err
+	}
+	log.Info().Str("new_wd", scriptWD).Msg("script moved")
+
+	return scriptWD, nil
+}
+
+// extract unpacks the archive to scriptWD using scriptTemp as a scratch dir.
+// If the archive content is a single dir, it becomes the new root dir.
+func extract(packedPath, scriptTemp, scriptWD string) error {
+	if err := os.RemoveAll(scriptTemp); err != nil {
+		return err
+	}
+
 	// extract archive
-	os.MkdirAll(scriptTemp, 0755)
-	archive.Unpack(context.TODO(), packedPath, scriptTemp)
+	if err := os.MkdirAll(scriptTemp, 0755); err != nil {
+		return err
+	}
+	if err := archive.Unpack(context.TODO(), packedPath, scriptTemp, unpackLimits()); err != nil {
+		os.RemoveAll(scriptTemp)
+		return fmt.Errorf("error unpacking script: %w", err)
+	}
 
 	// if content is single dir, move it to be new root dir
 	paths, err := ioutil.ReadDir(scriptTemp)
 	if err != nil {
-		return "", err
+		return err
 	}
 	if len(paths) == 1 && paths[0].IsDir() {
 		err = os.Rename(path.Join(scriptTemp, paths[0].Name()), scriptWD)
 		if err != nil {
-			return "", err
+			return err
 		}
 	} else {
 		err = os.Rename(scriptTemp, scriptWD)
 		if err != nil {
-			return "", err
+			return err
 		}
 	}
-	log.Info().Str("new_wd", scriptWD).Msg("script moved")
 
 	// remove temp
-	if err = os.RemoveAll(scriptTemp); err != nil {
-		return "", err
-	}
+	return os.RemoveAll(scriptTemp)
+}
 
-	return scriptWD, nil
+// unpackLimits returns archive limits, overridable with
+// SUPABENCH_ARCHIVE_MAX_FILES and SUPABENCH_ARCHIVE_MAX_SIZE.
+func unpackLimits() archive.Limits {
+	limits := archive.DefaultLimits
+	if n := viper.GetInt("ARCHIVE_MAX_FILES"); n > 0 {
+		limits.MaxFiles = n
+	}
+	if n := viper.GetInt64("ARCHIVE_MAX_SIZE"); n > 0 {
+		limits.MaxSize = n
+	}
+	return limits
 }
@@ -0,0 +1,173 @@
+package execution
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/pocketbase/dbx"
+	"github.com/rs/zerolog/log"
+	"github.com/supabase/supabench/models"
+)
+
+// Run statuses.
+const (
+	StatusPending      = "pending"
+	StatusProvisioning = "provisioning"
+	StatusRunning      = "running"
+	StatusSuccess      = "success"
+	StatusFail         = "fail"
+	StatusTimeout      = "timeout"
+	StatusCancelled    = "cancelled"
+	StatusTearingDown  = "tearing_down"
+	StatusFinished     = "finished"
+)
+
+// Sources of status transitions recorded in run events.
+const (
+	SourceScheduler = "scheduler"
+	SourceAPI       = "api"
+	SourceReaper    = "reaper"
+)
+
+// transitions lists the statuses a run may move to from each status. Dry
+// runs provision nothing and finish right away.
+var transitions = map[string][]string{
+	StatusPending:      {StatusProvisioning, StatusCancelled},
+	StatusProvisioning: {StatusRunning, StatusSuccess, StatusFail, StatusTimeout, StatusCancelled, StatusFinished},
+	StatusRunning:      {StatusSuccess, StatusFail, StatusTimeout, StatusCancelled},
+	StatusSuccess:      {StatusFail, StatusTearingDown},
+	StatusFail:         {StatusTearingDown},
+	StatusTimeout:      {StatusTearingDown},
+	StatusCancelled:    {StatusTearingDown},
+	StatusTearingDown:  {StatusFinished, StatusFail},
+	StatusFinished:     {},
+}
+
+// initialStatuses are the statuses a run may be created with. Loaders that
+// run outside of supabench report already finished runs.
+var initialStatuses = []string{StatusPending, StatusSuccess}
+
+// activeStatuses are the statuses of runs that hold the executor.
+var activeStatuses = []interface{}{
+	StatusProvisioning, StatusRunning, StatusSuccess, StatusFail, StatusTimeout, StatusTearingDown,
+}
+
+// doneStatuses are the statuses of runs that are done for good. Only those
+// are exported or cleaned up by retention.
+var doneStatuses = []interface{}{StatusFinished, StatusCancelled}
+
+var ErrIllegalTransition = errors.New("illegal run status transition")
+
+// CanTransition reports whether a run may move from one status to another.
+// Staying in the same status is always allowed.
+func CanTransition(from, to string) bool {
+	if from == to {
+		return true
+	}
+	if from == "" {
+		for _, s := range initialStatuses {
+			if s == to {
+				return true
+			}
+		}
+		return false
+	}
+	for _, s := range transitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckTransition validates moving the run with given id to a new status
+// and returns its current status.
+func (app *App) CheckTransition(runID, to string) (string, error) {
+	return checkTransition(app.PB.DB(), runID, to)
+}
+
+func checkTransition(db dbx.Builder, runID, to string) (string, error) {
+	var from string
+	if err := db.
+		Select("status").
+		From("runs").
+		Where(dbx.HashExp{"id": runID}).
+		Row(&from); err != nil && err != sql.ErrNoRows {
+		return "", err
+	}
+	if !CanTransition(from, to) {
+		return from, fmt.Errorf("%w: %s -> %s", ErrIllegalTransition, from, to)
+	}
+	return from, nil
+}
+
+// Transition moves the run to a new status, saving it together with the
+// given extra attributes and recording the transition in the run history.
+// The current status is checked in the same transaction, so concurrent
+// transitions, e.g. by the scheduler and the API, cannot both apply.
+func (app *App) Transition(run *models.Run, to, source, reason string, attrs ...string) error {
+	var from string
+	err := app.PB.DB().Transactional(func(tx *dbx.Tx) error {
+		var err error
+		if from, err = checkTransition(tx, run.Id, to); err != nil {
+			return err
+		}
+		run.Status = to
+		if err := tx.Model(run).Update(append([]string{"Status"}, attrs...)...); err != nil {
+			return err
+		}
+		if from == to {
+			return nil
+		}
+		return insertRunEvent(tx, run.Id, from, to, source, reason)
+	})
+	if err == nil {
+		app.countOutcome(run.Id, run.BenchmarkID, from, to)
+	}
+	if err == nil && finalTransition(from, to) {
+		observePhases(*run)
+	}
+	if err == nil && from != to && to == StatusFinished {
+		go app.pushSummary(*run)
+	}
+	return err
+}
+
+// finalTransition reports whether the run is done executing and tearing
+// down after moving from one status to another. A failed teardown leaves the
+// run to the reaper, but its phases are complete.
+func finalTransition(from, to string) bool {
+	if from == to {
+		return false
+	}
+	return to == StatusFinished || (from == StatusTearingDown && to == StatusFail)
+}
+
+// RecordRunEvent stores a status transition made outside of Transition,
+// e.g. through the collection API.
+func (app *App) RecordRunEvent(runID, from, to, source, reason string) {
+	if from == to {
+		return
+	}
+	if err := insertRunEvent(app.PB.DB(), runID, from, to, source, reason); err != nil {
+		log.Error().Err(err).Str("run_id", runID).Msg("error recording run event")
+	}
+	app.countOutcome(runID, "", from, to)
+}
+
+func insertRunEvent(db dbx.Builder, runID, from, to, source, reason string) error {
+	event := models.RunEvent{
+		RunID:      runID,
+		FromStatus: from,
+		ToStatus:   to,
+		Source:     source,
+	}
+	if reason != "" {
+		event.Reason = &reason
+	}
+	event.RefreshId()
+	event.RefreshCreated()
+	event.RefreshUpdated()
+	return db.Model(&event).Insert()
+}
@@ -0,0 +1,60 @@
+package execution
+
+import "testing"
+
+func TestFinalTransition(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     bool
+	}{
+		{from: StatusTearingDown, to: StatusFinished, want: true},
+		{from: StatusProvisioning, to: StatusFinished, want: true},
+		{from: StatusTearingDown, to: StatusFail, want: true},
+		{from: StatusRunning, to: StatusFail, want: false},
+		{from: StatusSuccess, to: StatusFail, want: false},
+		{from: StatusFail, to: StatusTearingDown, want: false},
+		{from: StatusFinished, to: StatusFinished, want: false},
+		{from: StatusFail, to: StatusFail, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.from+" -> "+tt.to, func(t *testing.T) {
+			if got := finalTransition(tt.from, tt.to); got != tt.want {
+				t.Errorf("finalTransition(%q, %q) = %v, want %v", tt.from, tt.to, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     bool
+	}{
+		{from: "", to: StatusPending, want: true},
+		{from: "", to: StatusSuccess, want: true},
+		{from: "", to: StatusRunning, want: false},
+		{from: StatusPending, to: StatusPending, want: true},
+		{from: StatusPending, to: StatusProvisioning, want: true},
+		{from: StatusPending, to: StatusCancelled, want: true},
+		{from: StatusPending, to: StatusRunning, want: false},
+		{from: StatusProvisioning, to: StatusFinished, want: true},
+		{from: StatusRunning, to: StatusCancelled, want: true},
+		{from: StatusRunning, to: StatusPending, want: false},
+		{from: StatusSuccess, to: StatusFail, want: true},
+		{from: StatusCancelled, to: StatusTearingDown, want: true},
+		{from: StatusCancelled, to: StatusFinished, want: false},
+		{from: StatusTearingDown, to: StatusFail, want: true},
+		{from: StatusFinished, to: StatusTearingDown, want: false},
+		{from: StatusFinished, to: StatusPending, want: false},
+		{from: "unknown", to: StatusFinished, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.from+" -> "+tt.to, func(t *testing.T) {
+			if got := CanTransition(tt.from, tt.to); got != tt.want {
+				t.Errorf("CanTransition(%q, %q) = %v, want %v", tt.from, tt.to, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package execution
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"time"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/rs/zerolog/log"
+	"github.com/supabase/supabench/internal/redact"
+	"github.com/supabase/supabench/internal/terraform"
+	"github.com/supabase/supabench/models"
+)
+
+// runMetaVars are set by supabench from the run itself.
+var runMetaVars = []string{"benchmark_id", "testrun_id", "testrun_name", "test_origin"}
+
+// ValidationReport is stored on the secret after every script upload.
+type ValidationReport struct {
+	Valid       bool                 `json:"valid"`
+	ValidatedAt time.Time            `json:"validated_at"`
+	Errors      []string             `json:"errors"`
+	Warnings    []string             `json:"warnings"`
+	Variables   []terraform.Variable `json:"variables"`
+	MissingVars []string             `json:"missing_vars"`
+}
+
+// CheckScript unpacks the archive into a temporary directory and makes sure
+// it contains terraform configuration that can be parsed. Errors are
+// redacted with r.
+func CheckScript(packedPath string, r *redact.Redactor) error {
+	dir, err := os.MkdirTemp("", "supabench-check-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	wd := path.Join(dir, "script_unpacked")
+	if err := extract(packedPath, path.Join(dir, "script_temp"), wd); err != nil {
+		return r.Error(err)
+	}
+	_, err = scriptVariables(wd)
+	return r.Error(err)
+}
+
+// ValidateSecret runs terraform validate against the secret's script, checks
+// that every required variable is provided and stores the report on the
+// secret.
+func (app *App) ValidateSecret(secretID string) (*ValidationReport, error) {
+	basePath, secret, err := app.getSecretByID(secretID)
+	if err != nil {
+		return nil, err
+	}
+	if secret.Script == nil || *secret.Script == "" {
+		return nil, fmt.Errorf("secret %s has no script", secretID)
+	}
+	r := newRedactor(app, secret)
+
+	report := &ValidationReport{
+		ValidatedAt: time.Now().UTC(),
+		Errors:      []string{},
+		Warnings:    []string{},
+		MissingVars: []string{},
+	}
+
+	dir, err := os.MkdirTemp("", "supabench-validate-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	wd := path.Join(dir, "script_unpacked")
+	if err := extract(path.Join(basePath, *secret.Script), path.Join(dir, "script_temp"), wd); err != nil {
+		report.Errors = append(report.Errors, r.Error(err).Error())
+		return report, app.saveValidation(secret, report)
+	}
+
+	report.Variables, err = scriptVariables(wd)
+	if err != nil {
+		report.Errors = append(report.Errors, r.Error(err).Error())
+		return report, app.saveValidation(secret, report)
+	}
+	report.MissingVars = app.missingVars(report.Variables, app.baseVars(secret.BenchmarkID, secret))
+
+	for _, module := range scriptModules(wd) {
+		out, err := app.TF.Validate(module)
+		if err != nil {
+			report.Errors = append(report.Errors, r.Error(err).Error())
+			continue
+		}
+		for _, d := range out.Diagnostics {
+			msg := r.String(d.Summary)
+			if d.Detail != "" {
+				msg += ": " + r.String(d.Detail)
+			}
+			if d.Severity == tfjson.DiagnosticSeverityError {
+				report.Errors = append(report.Errors, msg)
+			} else {
+				report.Warnings = append(report.Warnings, msg)
+			}
+		}
+	}
+
+	report.Valid = len(report.Errors) == 0
+	return report, app.saveValidation(secret, report)
+}
+
+// missingVars returns the required variables that are neither set by the
+// benchmark nor injected by supabench. They must be passed with every run.
+func (app *App) missingVars(declared []terraform.Variable, baseVars map[string]string) []string {
+	provided := map[string]bool{}
+	for k := range baseVars {
+		provided[k] = true
+	}
+	for _, k := range runMetaVars {
+		provided[k] = true
+	}
+	for _, k := range app.TF.InjectedVars() {
+		provided[k] = true
+	}
+
+	missing := []string{}
+	for _, v := range declared {
+		if v.Required && !provided[v.Name] {
+			missing = append(missing, v.Name)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+func (app *App) saveValidation(secret *models.Secret, report *ValidationReport) error {
+	b, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	validation := string(b)
+	secret.Validation = &validation
+	if err := app.PB.DB().Model(secret).Update("Validation"); err != nil {
+		return err
+	}
+
+	log.Info().
+		Str("secret_id", secret.Id).
+		Bool("valid", report.Valid).
+		Strs("missing_vars", report.MissingVars).
+		Msg("script validated")
+	return nil
+}
@@ -0,0 +1,78 @@
+package execution
+
+import (
+	"archive/tar"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/supabase/supabench/internal/redact"
+)
+
+func TestCheckScript(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		wantErr string
+	}{
+		{
+			name:  "valid",
+			files: map[string]string{"main.tf": `variable "rps" {}`},
+		},
+		{
+			name:    "illegal path",
+			files:   map[string]string{"../hunter22.tf": `variable "rps" {}`},
+			wantErr: `illegal path in archive: "../***.tf"`,
+		},
+		{
+			name:    "invalid configuration",
+			files:   map[string]string{"main.tf": `variable "rps" {`},
+			wantErr: "Unclosed configuration block",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			packed := filepath.Join(t.TempDir(), "script.tar")
+			writeScript(t, packed, tt.files)
+
+			err := CheckScript(packed, redact.New("hunter22"))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("CheckScript() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("CheckScript() error = %v, want %q", err, tt.wantErr)
+			}
+			if strings.Contains(err.Error(), "hunter22") {
+				t.Errorf("CheckScript() error = %v, want the secret redacted", err)
+			}
+		})
+	}
+}
+
+func writeScript(t *testing.T, name string, files map[string]string) {
+	t.Helper()
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	w := tar.NewWriter(f)
+	for path, body := range files {
+		hdr := &tar.Header{Name: path, Mode: 0644, Typeflag: tar.TypeReg, Size: int64(len(body))}
+		if err := w.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
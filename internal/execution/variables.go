@@ -0,0 +1,156 @@
+package execution
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/supabase/supabench/internal/terraform"
+)
+
+// BenchmarkVariable is a terraform variable of a benchmark together with
+// the place its value comes from.
+type BenchmarkVariable struct {
+	terraform.Variable
+	// SetBySecret is true if the secret vars provide a value.
+	SetBySecret bool `json:"set_by_secret"`
+	// SetByBenchmark is true if the vars of the benchmark meta provide a
+	// value.
+	SetByBenchmark bool `json:"set_by_benchmark"`
+	// Injected is true if supabench sets the value on every run.
+	Injected bool `json:"injected"`
+}
+
+// ErrInspectVars is returned when the variables of a benchmark script
+// cannot be read.
+var ErrInspectVars = errors.New("cannot inspect benchmark variables")
+
+// scriptVars caches the variables declared by a script archive, by the hash
+// of the archive.
+var scriptVars sync.Map
+
+// BenchmarkVariables unpacks the benchmark script and returns the variables
+// declared by its root module.
+func (app *App) BenchmarkVariables(benchmarkID string) ([]BenchmarkVariable, error) {
+	basePath, secret, err := app.getSecretPath(benchmarkID)
+	if err != nil {
+		return nil, err
+	}
+	if secret.Script == nil || *secret.Script == "" {
+		return nil, errors.New("secret script is nil, link is not supported yet")
+	}
+
+	declared, err := archiveVariables(path.Join(basePath, *secret.Script))
+	if err != nil {
+		return nil, err
+	}
+
+	secretVars := getVars(secret.Vars)
+	benchmarkVars := app.benchmarkVars(benchmarkID)
+	injected := map[string]bool{}
+	for _, k := range runMetaVars {
+		injected[k] = true
+	}
+	for _, k := range app.TF.InjectedVars() {
+		injected[k] = true
+	}
+
+	vars := make([]BenchmarkVariable, 0, len(declared))
+	for _, v := range declared {
+		_, setBySecret := secretVars[v.Name]
+		_, setByBenchmark := benchmarkVars[v.Name]
+		if v.Sensitive {
+			v.Default = nil
+		}
+		vars = append(vars, BenchmarkVariable{
+			Variable:       v,
+			SetBySecret:    setBySecret,
+			SetByBenchmark: setByBenchmark,
+			Injected:       injected[v.Name],
+		})
+	}
+
+	return vars, nil
+}
+
+// archiveVariables returns the variables declared by the root module of the
+// script archive, only unpacking archives it has not seen before.
+func archiveVariables(archive string) ([]terraform.Variable, error) {
+	hash, err := fileHash(archive)
+	if err != nil {
+		return nil, err
+	}
+	if declared, ok := scriptVars.Load(hash); ok {
+		return declared.([]terraform.Variable), nil
+	}
+
+	dir, err := os.MkdirTemp("", "supabench-inspect-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	wd := path.Join(dir, "script_unpacked")
+	if err := extract(archive, path.Join(dir, "script_temp"), wd); err != nil {
+		return nil, err
+	}
+	declared, err := scriptVariables(wd)
+	if err != nil {
+		return nil, err
+	}
+	scriptVars.Store(hash, declared)
+	return declared, nil
+}
+
+// CheckRunVars makes sure every run var is declared by the benchmark and
+// has the declared type. ErrInspectVars is returned if the benchmark cannot
+// be inspected.
+func (app *App) CheckRunVars(benchmarkID string, runVars map[string]string) error {
+	if len(runVars) == 0 {
+		return nil
+	}
+
+	declared, err := app.BenchmarkVariables(benchmarkID)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInspectVars, err)
+	}
+	byName := map[string]BenchmarkVariable{}
+	for _, v := range declared {
+		byName[v.Name] = v
+	}
+
+	unknown := []string{}
+	for k, value := range runVars {
+		v, ok := byName[k]
+		if !ok {
+			unknown = append(unknown, k)
+			continue
+		}
+		if err := v.Check(value); err != nil {
+			return err
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("unknown vars: %s", strings.Join(unknown, ", "))
+	}
+
+	return nil
+}
+
+// ParseVars parses run vars, which must be a json object of strings.
+func ParseVars(v *string) (map[string]string, error) {
+	vars := map[string]string{}
+	if v == nil || *v == "" {
+		return vars, nil
+	}
+	if err := json.Unmarshal([]byte(*v), &vars); err != nil {
+		return nil, errors.New("vars must be a map of strings")
+	}
+	return vars, nil
+}
@@ -0,0 +1,185 @@
+package execution
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+
+	"github.com/pocketbase/dbx"
+	"github.com/rs/zerolog/log"
+	"github.com/supabase/supabench/internal/redact"
+	"github.com/supabase/supabench/models"
+)
+
+// RecordScriptVersion stores the current script of the secret as a new
+// version, unless the same content was already recorded.
+func (app *App) RecordScriptVersion(secretID string, uploader, note string) (*models.ScriptVersion, error) {
+	basePath, secret, err := app.getSecretByID(secretID)
+	if err != nil {
+		return nil, err
+	}
+	if secret.Script == nil || *secret.Script == "" {
+		return nil, nil
+	}
+	packedPath := path.Join(basePath, *secret.Script)
+
+	hash, err := fileHash(packedPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var version models.ScriptVersion
+	err = app.PB.DB().
+		Select().
+		Where(dbx.HashExp{"secret_id": secret.Id, "hash": hash}).
+		One(&version)
+	if err == nil {
+		return &version, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	version = models.ScriptVersion{
+		SecretID:    secret.Id,
+		BenchmarkID: secret.BenchmarkID,
+		Script:      *secret.Script,
+		Hash:        hash,
+	}
+	if uploader != "" {
+		version.Uploader = &uploader
+	}
+	if note != "" {
+		version.Note = &note
+	}
+	version.RefreshId()
+	version.RefreshCreated()
+	version.RefreshUpdated()
+
+	versionPath, err := app.scriptVersionPath(&version)
+	if err != nil {
+		return nil, err
+	}
+	if err := copyFile(packedPath, versionPath); err != nil {
+		return nil, err
+	}
+
+	if err := app.PB.DB().Model(&version).Insert(); err != nil {
+		return nil, err
+	}
+
+	log.Info().
+		Str("secret_id", secret.Id).
+		Str("version_id", version.Id).
+		Str("hash", hash).
+		Msg("recorded new script version")
+	return &version, nil
+}
+
+// FindScriptVersion returns the script version by id.
+func (app *App) FindScriptVersion(id string) (*models.ScriptVersion, error) {
+	var version models.ScriptVersion
+	if err := app.PB.DB().
+		Select().
+		Where(dbx.HashExp{"id": id}).
+		One(&version); err != nil {
+		return nil, err
+	}
+	return &version, nil
+}
+
+// runScript returns the script version the run has to execute and the path
+// to its archive. Runs pinned to a version use it, other runs use the
+// current script of the secret.
+func (app *App) runScript(run *models.Run, secret *models.Secret) (*models.ScriptVersion, string, error) {
+	var version *models.ScriptVersion
+	var err error
+	if run.ScriptVersionID != nil && *run.ScriptVersionID != "" {
+		version, err = app.FindScriptVersion(*run.ScriptVersionID)
+		if err != nil {
+			return nil, "", fmt.Errorf("error getting script version %s: %w", *run.ScriptVersionID, err)
+		}
+		if version.BenchmarkID != run.BenchmarkID {
+			return nil, "", fmt.Errorf("script version %s belongs to another benchmark", version.Id)
+		}
+	} else {
+		// scripts uploaded before versioning are recorded on first use
+		version, err = app.RecordScriptVersion(secret.Id, "", "")
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	packedPath, err := app.scriptVersionPath(version)
+	if err != nil {
+		return nil, "", err
+	}
+	return version, packedPath, nil
+}
+
+func (app *App) scriptVersionPath(version *models.ScriptVersion) (string, error) {
+	versions, err := app.PB.Dao().FindCollectionByNameOrId("script_versions")
+	if err != nil {
+		return "", err
+	}
+	return path.Join("pb_data/storage", versions.Id, version.Id, version.Script), nil
+}
+
+// resolvedVars returns the vars of the run as json, with the values that
+// come from the secret masked.
+func resolvedVars(vars, secretVars, runVars map[string]string) (string, error) {
+	resolved := map[string]string{}
+	for k, v := range vars {
+		_, fromSecret := secretVars[k]
+		_, fromRun := runVars[k]
+		if fromSecret && !fromRun {
+			v = redact.Mask
+		}
+		resolved[k] = v
+	}
+
+	b, err := json.Marshal(resolved)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func fileHash(name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	if err := os.MkdirAll(path.Dir(dst), 0755); err != nil {
+		return err
+	}
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, in)
+	return err
+}
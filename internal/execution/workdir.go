@@ -0,0 +1,82 @@
+package execution
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/spf13/viper"
+	"github.com/supabase/supabench/internal/terraform"
+)
+
+// Terraform runs in working directories outside of the secrets storage, one
+// per run and one per environment. They hold the terraform state and are
+// only removed once everything in them was destroyed, so that a failed
+// teardown can always be retried.
+
+// stateDir is the root of the working directories, configured with
+// SUPABENCH_STATE_DIR.
+func stateDir() string {
+	if dir := viper.GetString("STATE_DIR"); dir != "" {
+		return dir
+	}
+	return "pb_data/terraform"
+}
+
+// runDir is the working directory of the run.
+func runDir(runID string) string {
+	return path.Join(stateDir(), "runs", runID)
+}
+
+// environmentDir holds a copy of the script the environment was created
+// from, so that its module can refer to the rest of the script.
+func environmentDir(envID string) string {
+	return path.Join(stateDir(), "environments", envID)
+}
+
+// environmentWD is the working directory of the environment module.
+// Environments created before the whole script was kept have the module at
+// the root.
+func environmentWD(envID string) string {
+	wd := path.Join(environmentDir(envID), environmentModule)
+	if !terraform.IsModuleDir(wd) && terraform.IsModuleDir(environmentDir(envID)) {
+		return environmentDir(envID)
+	}
+	return wd
+}
+
+// copyDir copies the unpacked script in src to dst, keeping file modes and
+// symlinks.
+func copyDir(src, dst string) error {
+	return filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm()|0700)
+		case info.Mode()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		default:
+			if err := copyFile(p, target); err != nil {
+				return err
+			}
+			return os.Chmod(target, info.Mode().Perm())
+		}
+	})
+}
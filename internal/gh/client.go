@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/google/go-github/v64/github"
 	"github.com/pocketbase/dbx"
@@ -94,6 +95,7 @@ func (c *Client) AddOrUpdateComment(ctx context.Context, prlink string, comment
 			},
 		)
 		if err != nil {
+			apiErrors.WithLabelValues("create_comment").Inc()
 			return "", fmt.Errorf("error creating PR comment: %w", err)
 		}
 		pr.GHCommentLink = prc.URL
@@ -112,6 +114,7 @@ func (c *Client) AddOrUpdateComment(ctx context.Context, prlink string, comment
 			},
 		)
 		if err != nil {
+			apiErrors.WithLabelValues("edit_comment").Inc()
 			return "", fmt.Errorf("error editing PR comment: %w", err)
 		}
 	}
@@ -170,6 +173,12 @@ Stay tuned for updates! 📊✨
 `, grafanaLink)
 }
 
+func SupersededNoteString(runNames []string) string {
+	return fmt.Sprintf(
+		"⏭️ Superseded queued runs: `%s`\n",
+		strings.Join(runNames, "`, `"))
+}
+
 func SuccessCommentString(grafanaLink string, mdResult string) string {
 	return fmt.Sprintf(
 		"✅ **Benchmark Run Completed Successfully!** ✅\n\n"+
@@ -198,3 +207,47 @@ func SmthWentWrongCommentString() string {
 		"❌ **Something Went Wrong!** ❌\n\n" +
 			"Please check the terraform and supabench logs for more details and contact admin to find out what happened.")
 }
+
+// PhaseTiming is the duration of a run phase shown in PR comments.
+type PhaseTiming struct {
+	Name     string
+	Duration time.Duration
+	Failed   bool
+}
+
+func PhaseTimingsString(phases []PhaseTiming) string {
+	if len(phases) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("**Timings:**\n\n| Phase | Duration |\n|---|---|\n")
+	for _, p := range phases {
+		d := "…"
+		if p.Duration > 0 {
+			d = p.Duration.Round(time.Second).String()
+		}
+		if p.Failed {
+			d += " ❌"
+		}
+		fmt.Fprintf(&b, "| %s | %s |\n", p.Name, d)
+	}
+	return b.String()
+}
+
+// maxPlanLength keeps dry run comments below the GitHub comment size limit.
+const maxPlanLength = 60000
+
+func DryRunCommentString(plan string) string {
+	if len(plan) > maxPlanLength {
+		plan = "...\n" + plan[len(plan)-maxPlanLength:]
+	}
+	return fmt.Sprintf(
+		"📝 **Benchmark Dry Run Planned!** 📝\n\n"+
+			"Nothing was provisioned.\n\n"+
+			"<details><summary>Terraform plan</summary>\n\n"+
+			"```\n"+
+			"%s\n"+
+			"```\n"+
+			"</details>",
+		plan)
+}
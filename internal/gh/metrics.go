@@ -0,0 +1,11 @@
+package gh
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var apiErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "supabench_github_api_errors_total",
+	Help: "GitHub API requests that failed.",
+}, []string{"operation"})
@@ -0,0 +1,60 @@
+package manifest
+
+import (
+	"errors"
+	"io"
+
+	"github.com/labstack/echo/v5"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/supabase/supabench/internal/execution"
+)
+
+// maxManifestSize limits the request body of apply.
+const maxManifestSize = 4 << 20
+
+// ApplyHandler creates or updates the projects, benchmarks and secret vars
+// described by the YAML or JSON manifest in the request body. With
+// ?dry_run=true only the changes are reported.
+func ApplyHandler(app *execution.App) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		body, err := io.ReadAll(io.LimitReader(c.Request().Body, maxManifestSize))
+		if err != nil {
+			return c.JSON(400, map[string]string{"error": err.Error()})
+		}
+		m, err := execution.ParseManifest(body)
+		if err != nil {
+			return c.JSON(400, map[string]string{"error": err.Error()})
+		}
+
+		// privileged users own what they create and may only change their
+		// own records, admins act on behalf of the manifest owner
+		var ownerID string
+		restrict := false
+		if user, _ := c.Get(apis.ContextUserKey).(*models.User); user != nil {
+			if m.Owner != "" && m.Owner != user.Email {
+				return c.JSON(400, map[string]string{"error": "owner must be the requesting user"})
+			}
+			ownerID = user.Id
+			restrict = true
+		} else {
+			if m.Owner == "" {
+				return c.JSON(400, map[string]string{"error": "missing required field: owner"})
+			}
+			owner, err := app.PB.Dao().FindUserByEmail(m.Owner)
+			if err != nil {
+				return c.JSON(400, map[string]string{"error": "owner not found: " + m.Owner})
+			}
+			ownerID = owner.Id
+		}
+
+		result, err := app.ApplyManifest(m, ownerID, restrict, c.QueryParam("dry_run") == "true")
+		if errors.Is(err, execution.ErrNotOwner) {
+			return c.JSON(403, map[string]string{"error": err.Error()})
+		}
+		if err != nil {
+			return c.JSON(500, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(200, result)
+	}
+}
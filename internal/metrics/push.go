@@ -0,0 +1,201 @@
+// Package metrics pushes run results to time series databases.
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Formats of the endpoints points are pushed to.
+const (
+	FormatInflux      = "influx"
+	FormatRemoteWrite = "remote_write"
+)
+
+// invalidNameChars matches what may not be part of a Prometheus metric or
+// label name.
+var invalidNameChars = regexp.MustCompile(`[^a-zA-Z0-9_]+`)
+
+// Point is a set of values measured at the same time. Pushed to Prometheus
+// remote write, every field becomes a series named <name>_<field>, which
+// is how VictoriaMetrics names influx fields as well.
+type Point struct {
+	Name   string
+	Tags   map[string]string
+	Fields map[string]float64
+	Time   time.Time
+}
+
+// Pusher writes points to an Influx line protocol or Prometheus remote
+// write endpoint.
+type Pusher struct {
+	url    string
+	format string
+	client *http.Client
+}
+
+// NewPusher returns a pusher for the endpoint at url, e.g.
+// http://victoriametrics:8428/write for the influx format or
+// http://victoriametrics:8428/api/v1/write for remote write.
+func NewPusher(url, format string) (*Pusher, error) {
+	if format == "" {
+		format = FormatInflux
+	}
+	if format != FormatInflux && format != FormatRemoteWrite {
+		return nil, fmt.Errorf("unknown metrics push format %q, expected %s or %s", format, FormatInflux, FormatRemoteWrite)
+	}
+	return &Pusher{
+		url:    url,
+		format: format,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// Push writes the points in one request.
+func (p *Pusher) Push(ctx context.Context, points ...Point) error {
+	var body []byte
+	headers := map[string]string{}
+	switch p.format {
+	case FormatRemoteWrite:
+		body = snappy.Encode(nil, remoteWriteRequest(points))
+		headers["Content-Type"] = "application/x-protobuf"
+		headers["Content-Encoding"] = "snappy"
+		headers["X-Prometheus-Remote-Write-Version"] = "0.1.0"
+	default:
+		body = influxLines(points)
+		headers["Content-Type"] = "text/plain; charset=utf-8"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("pushing metrics: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// SanitizeName turns s into a valid metric or label name, e.g.
+// http_req_duration.p(95) into http_req_duration_p_95.
+func SanitizeName(s string) string {
+	s = strings.Trim(invalidNameChars.ReplaceAllString(s, "_"), "_")
+	if s != "" && s[0] >= '0' && s[0] <= '9' {
+		s = "_" + s
+	}
+	return s
+}
+
+// influxLines encodes the points in the Influx line protocol. Empty tags
+// and values that are not finite cannot be represented and are left out.
+func influxLines(points []Point) []byte {
+	var buf bytes.Buffer
+	measurement := strings.NewReplacer(",", `\,`, " ", `\ `)
+	key := strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+	for _, p := range points {
+		fields := []string{}
+		for _, name := range sortedKeys(p.Fields) {
+			v := p.Fields[name]
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				continue
+			}
+			fields = append(fields, key.Replace(name)+"="+strconv.FormatFloat(v, 'f', -1, 64))
+		}
+		if len(fields) == 0 {
+			continue
+		}
+
+		buf.WriteString(measurement.Replace(p.Name))
+		for _, name := range sortedKeys(p.Tags) {
+			if p.Tags[name] == "" {
+				continue
+			}
+			buf.WriteString("," + key.Replace(name) + "=" + key.Replace(p.Tags[name]))
+		}
+		buf.WriteString(" " + strings.Join(fields, ","))
+		buf.WriteString(" " + strconv.FormatInt(p.Time.UnixNano(), 10) + "\n")
+	}
+	return buf.Bytes()
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// remoteWriteRequest encodes the points as a Prometheus remote write
+// WriteRequest protobuf message.
+func remoteWriteRequest(points []Point) []byte {
+	var req []byte
+	for _, p := range points {
+		for _, field := range sortedKeys(p.Fields) {
+			v := p.Fields[field]
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				continue
+			}
+
+			labels := map[string]string{"__name__": p.Name + "_" + field}
+			for name, value := range p.Tags {
+				if value != "" {
+					labels[name] = value
+				}
+			}
+			names := make([]string, 0, len(labels))
+			for name := range labels {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+
+			// TimeSeries{labels = 1, samples = 2}
+			var ts []byte
+			for _, name := range names {
+				// Label{name = 1, value = 2}
+				var label []byte
+				label = protowire.AppendTag(label, 1, protowire.BytesType)
+				label = protowire.AppendString(label, name)
+				label = protowire.AppendTag(label, 2, protowire.BytesType)
+				label = protowire.AppendString(label, labels[name])
+				ts = protowire.AppendTag(ts, 1, protowire.BytesType)
+				ts = protowire.AppendBytes(ts, label)
+			}
+			// Sample{value = 1, timestamp = 2}
+			var sample []byte
+			sample = protowire.AppendTag(sample, 1, protowire.Fixed64Type)
+			sample = protowire.AppendFixed64(sample, math.Float64bits(v))
+			sample = protowire.AppendTag(sample, 2, protowire.VarintType)
+			sample = protowire.AppendVarint(sample, uint64(p.Time.UnixMilli()))
+			ts = protowire.AppendTag(ts, 2, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, sample)
+
+			// WriteRequest{timeseries = 1}
+			req = protowire.AppendTag(req, 1, protowire.BytesType)
+			req = protowire.AppendBytes(req, ts)
+		}
+	}
+	return req
+}
@@ -0,0 +1,245 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+var at = time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+
+func TestSanitizeName(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{in: "http_req_duration", want: "http_req_duration"},
+		{in: "http_req_duration.p(95)", want: "http_req_duration_p_95"},
+		{in: "checks{scenario:login}", want: "checks_scenario_login"},
+		{in: "95th percentile", want: "_95th_percentile"},
+		{in: "..", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			if got := SanitizeName(tt.in); got != tt.want {
+				t.Errorf("SanitizeName(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInfluxLines(t *testing.T) {
+	tests := []struct {
+		name   string
+		points []Point
+		want   string
+	}{
+		{
+			name: "point",
+			points: []Point{{
+				Name:   "supabench_run",
+				Tags:   map[string]string{"benchmark": "broadcast", "project": "realtime"},
+				Fields: map[string]float64{"vus_value": 10, "http_req_duration_avg": 51.5},
+				Time:   at,
+			}},
+			want: "supabench_run,benchmark=broadcast,project=realtime http_req_duration_avg=51.5,vus_value=10 1792404000000000000\n",
+		},
+		{
+			name: "escaped",
+			points: []Point{{
+				Name:   "supabench run,x",
+				Tags:   map[string]string{"run name": "pr=1, retry"},
+				Fields: map[string]float64{"a b": 1},
+				Time:   at,
+			}},
+			want: `supabench\ run\,x,run\ name=pr\=1\,\ retry a\ b=1 1792404000000000000` + "\n",
+		},
+		{
+			name: "empty tags and values that are not finite left out",
+			points: []Point{{
+				Name:   "supabench_run",
+				Tags:   map[string]string{"origin": "", "benchmark": "b"},
+				Fields: map[string]float64{"nan": math.NaN(), "inf": math.Inf(1), "ok": 0.5},
+				Time:   at,
+			}},
+			want: "supabench_run,benchmark=b ok=0.5 1792404000000000000\n",
+		},
+		{
+			name: "no fields",
+			points: []Point{
+				{Name: "empty", Fields: map[string]float64{"nan": math.NaN()}, Time: at},
+				{Name: "next", Fields: map[string]float64{"v": 1}, Time: at},
+			},
+			want: "next v=1 1792404000000000000\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(influxLines(tt.points)); got != tt.want {
+				t.Errorf("influxLines() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+type series struct {
+	labels    map[string]string
+	value     float64
+	timestamp int64
+}
+
+// decodeWriteRequest reads the time series of a remote write request.
+func decodeWriteRequest(t *testing.T, b []byte) []series {
+	t.Helper()
+	fields := func(b []byte, fn func(num protowire.Number, typ protowire.Type, v []byte, n uint64)) {
+		for len(b) > 0 {
+			num, typ, n := protowire.ConsumeTag(b)
+			if n < 0 {
+				t.Fatalf("invalid tag: %v", protowire.ParseError(n))
+			}
+			b = b[n:]
+			switch typ {
+			case protowire.BytesType:
+				v, n := protowire.ConsumeBytes(b)
+				if n < 0 {
+					t.Fatalf("invalid bytes: %v", protowire.ParseError(n))
+				}
+				fn(num, typ, v, 0)
+				b = b[n:]
+			case protowire.Fixed64Type:
+				v, n := protowire.ConsumeFixed64(b)
+				fn(num, typ, nil, v)
+				b = b[n:]
+			case protowire.VarintType:
+				v, n := protowire.ConsumeVarint(b)
+				fn(num, typ, nil, v)
+				b = b[n:]
+			default:
+				t.Fatalf("unexpected wire type %v", typ)
+			}
+		}
+	}
+
+	var out []series
+	fields(b, func(num protowire.Number, _ protowire.Type, ts []byte, _ uint64) {
+		s := series{labels: map[string]string{}}
+		fields(ts, func(num protowire.Number, _ protowire.Type, v []byte, _ uint64) {
+			switch num {
+			case 1:
+				var name, value string
+				fields(v, func(num protowire.Number, _ protowire.Type, v []byte, _ uint64) {
+					if num == 1 {
+						name = string(v)
+					} else {
+						value = string(v)
+					}
+				})
+				s.labels[name] = value
+			case 2:
+				fields(v, func(num protowire.Number, _ protowire.Type, _ []byte, n uint64) {
+					if num == 1 {
+						s.value = math.Float64frombits(n)
+					} else {
+						s.timestamp = int64(n)
+					}
+				})
+			}
+		})
+		out = append(out, s)
+	})
+	return out
+}
+
+func TestRemoteWriteRequest(t *testing.T) {
+	points := []Point{{
+		Name:   "supabench_run",
+		Tags:   map[string]string{"benchmark": "broadcast", "origin": ""},
+		Fields: map[string]float64{"vus_value": 10, "http_req_duration_avg": 51.5, "nan": math.NaN()},
+		Time:   at,
+	}}
+
+	want := []series{
+		{labels: map[string]string{"__name__": "supabench_run_http_req_duration_avg", "benchmark": "broadcast"}, value: 51.5, timestamp: at.UnixMilli()},
+		{labels: map[string]string{"__name__": "supabench_run_vus_value", "benchmark": "broadcast"}, value: 10, timestamp: at.UnixMilli()},
+	}
+	if got := decodeWriteRequest(t, remoteWriteRequest(points)); !reflect.DeepEqual(got, want) {
+		t.Errorf("remoteWriteRequest() = %+v, want %+v", got, want)
+	}
+}
+
+func TestPush(t *testing.T) {
+	point := Point{Name: "supabench_run", Fields: map[string]float64{"v": 1}, Time: at}
+
+	tests := []struct {
+		format      string
+		status      int
+		wantType    string
+		wantBody    func(t *testing.T, body []byte)
+		wantErr     bool
+		wantFormErr bool
+	}{
+		{
+			format:   FormatInflux,
+			status:   http.StatusNoContent,
+			wantType: "text/plain; charset=utf-8",
+			wantBody: func(t *testing.T, body []byte) {
+				if string(body) != "supabench_run v=1 1792404000000000000\n" {
+					t.Errorf("body = %q", body)
+				}
+			},
+		},
+		{
+			format:   FormatRemoteWrite,
+			status:   http.StatusNoContent,
+			wantType: "application/x-protobuf",
+			wantBody: func(t *testing.T, body []byte) {
+				b, err := snappy.Decode(nil, body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := decodeWriteRequest(t, b); len(got) != 1 || got[0].labels["__name__"] != "supabench_run_v" {
+					t.Errorf("series = %+v", got)
+				}
+			},
+		},
+		{format: FormatInflux, status: http.StatusBadRequest, wantErr: true},
+		{format: "graphite", wantFormErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format+"/"+http.StatusText(tt.status), func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if got := r.Header.Get("Content-Type"); tt.wantType != "" && got != tt.wantType {
+					t.Errorf("Content-Type = %q, want %q", got, tt.wantType)
+				}
+				body, _ := io.ReadAll(r.Body)
+				if tt.wantBody != nil {
+					tt.wantBody(t, body)
+				}
+				w.WriteHeader(tt.status)
+			}))
+			defer srv.Close()
+
+			p, err := NewPusher(srv.URL, tt.format)
+			if (err != nil) != tt.wantFormErr {
+				t.Fatalf("NewPusher() error = %v, wantErr %v", err, tt.wantFormErr)
+			}
+			if err != nil {
+				return
+			}
+			if err := p.Push(context.Background(), point); (err != nil) != tt.wantErr {
+				t.Errorf("Push() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
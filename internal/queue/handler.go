@@ -0,0 +1,78 @@
+package queue
+
+import (
+	"errors"
+
+	"github.com/labstack/echo/v5"
+	"github.com/supabase/supabench/internal/execution"
+)
+
+type reorderRequest struct {
+	IDs []string `json:"ids"`
+}
+
+type priorityRequest struct {
+	Priority int `json:"priority"`
+}
+
+// ListHandler returns the pending runs in execution order.
+func ListHandler(app *execution.App) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		queue, err := app.Queue()
+		if err != nil {
+			return c.JSON(500, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(200, queue)
+	}
+}
+
+// BumpHandler moves a pending run to the front of the queue.
+func BumpHandler(app *execution.App) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return respond(c, app, app.BumpRun(c.PathParam("id")))
+	}
+}
+
+// PriorityHandler sets the priority of a pending run.
+func PriorityHandler(app *execution.App) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := priorityRequest{}
+		if err := c.Echo().JSONSerializer.Deserialize(c, &req); err != nil {
+			return c.JSON(400, map[string]string{"error": err.Error()})
+		}
+		return respond(c, app, app.SetRunPriority(c.PathParam("id"), req.Priority))
+	}
+}
+
+// ReorderHandler moves the given pending runs to the front of the queue in
+// the given order.
+func ReorderHandler(app *execution.App) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := reorderRequest{}
+		if err := c.Echo().JSONSerializer.Deserialize(c, &req); err != nil {
+			return c.JSON(400, map[string]string{"error": err.Error()})
+		}
+		if len(req.IDs) == 0 {
+			return c.JSON(400, map[string]string{"error": "missing required field: ids"})
+		}
+		return respond(c, app, app.ReorderQueue(req.IDs))
+	}
+}
+
+// DropHandler removes a pending run from the queue.
+func DropHandler(app *execution.App) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return respond(c, app, app.DropRun(c.PathParam("id")))
+	}
+}
+
+// respond returns the updated queue or the error of the queue operation.
+func respond(c echo.Context, app *execution.App, err error) error {
+	if errors.Is(err, execution.ErrNotQueued) {
+		return c.JSON(404, map[string]string{"error": err.Error()})
+	}
+	if err != nil {
+		return c.JSON(500, map[string]string{"error": err.Error()})
+	}
+	return ListHandler(app)(c)
+}
@@ -0,0 +1,143 @@
+package redact
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Mask is what every secret value is replaced with.
+const Mask = "***"
+
+// minLength is the shortest value that is treated as a secret. Shorter values
+// (empty strings, booleans, small numbers) would mangle unrelated output.
+const minLength = 4
+
+// Redactor scrubs known secret values from arbitrary text.
+type Redactor struct {
+	secrets []string
+}
+
+// New returns a redactor that knows the given secret values.
+func New(values ...string) *Redactor {
+	r := &Redactor{}
+	r.Add(values...)
+	return r
+}
+
+// Add registers more secret values. Values that are too short to be
+// meaningful secrets, numbers, booleans and null are ignored: they are
+// settings like VU counts rather than secrets, and masking them would mangle
+// unrelated output.
+func (r *Redactor) Add(values ...string) {
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if len(v) < minLength || !secretLike(v) {
+			continue
+		}
+		r.secrets = append(r.secrets, v)
+
+		// secrets may also show up json-encoded, e.g. in k6 raw summaries
+		if b, err := json.Marshal(v); err == nil {
+			if escaped := string(b[1 : len(b)-1]); escaped != v {
+				r.secrets = append(r.secrets, escaped)
+			}
+		}
+	}
+
+	// replace longest values first so that secrets containing other secrets
+	// are masked as a whole
+	sort.SliceStable(r.secrets, func(i, j int) bool {
+		return len(r.secrets[i]) > len(r.secrets[j])
+	})
+}
+
+func secretLike(v string) bool {
+	if _, err := strconv.ParseFloat(v, 64); err == nil {
+		return false
+	}
+	if _, err := strconv.ParseBool(v); err == nil {
+		return false
+	}
+	return v != "null"
+}
+
+// AddMap registers every value of the map as a secret.
+func (r *Redactor) AddMap(m map[string]string) {
+	for _, v := range m {
+		r.Add(v)
+	}
+}
+
+// String returns s with every known secret replaced by Mask.
+func (r *Redactor) String(s string) string {
+	if r == nil {
+		return s
+	}
+	for _, secret := range r.secrets {
+		s = strings.ReplaceAll(s, secret, Mask)
+	}
+	return s
+}
+
+// JSON returns the JSON document b with every known secret in its strings
+// replaced by Mask. Numbers, keys and the structure are kept, so the result
+// stays valid JSON. Input that is not JSON is redacted like a string.
+func (r *Redactor) JSON(b []byte) []byte {
+	if r == nil || len(r.secrets) == 0 {
+		return b
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return []byte(r.String(string(b)))
+	}
+	out, err := json.Marshal(r.value(v))
+	if err != nil {
+		return []byte(r.String(string(b)))
+	}
+	return out
+}
+
+func (r *Redactor) value(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		return r.String(v)
+	case []interface{}:
+		for i := range v {
+			v[i] = r.value(v[i])
+		}
+	case map[string]interface{}:
+		for k := range v {
+			v[k] = r.value(v[k])
+		}
+	}
+	return v
+}
+
+// StringPtr is like String but for optional values.
+func (r *Redactor) StringPtr(s *string) *string {
+	if s == nil {
+		return nil
+	}
+	redacted := r.String(*s)
+	return &redacted
+}
+
+// Error returns an error with the same message as err but with every known
+// secret replaced by Mask. It returns nil if err is nil.
+func (r *Redactor) Error(err error) error {
+	if err == nil {
+		return nil
+	}
+	msg := err.Error()
+	redacted := r.String(msg)
+	if redacted == msg {
+		return err
+	}
+	return errors.New(redacted)
+}
@@ -0,0 +1,19 @@
+package resource
+
+import (
+	"github.com/labstack/echo/v5"
+	"github.com/supabase/supabench/internal/execution"
+)
+
+// ListHandler returns the terraform working directories that may still hold
+// provisioned resources, per run.
+func ListHandler(app *execution.App) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		resources, err := app.ListResources()
+		if err != nil {
+			return c.JSON(500, map[string]string{"error": err.Error()})
+		}
+
+		return c.JSON(200, resources)
+	}
+}
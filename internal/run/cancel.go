@@ -0,0 +1,26 @@
+package run
+
+import (
+	"errors"
+
+	"github.com/labstack/echo/v5"
+	"github.com/supabase/supabench/internal/execution"
+)
+
+// CancelHandler cancels a pending or executing run. Executing runs are
+// interrupted and torn down in the background.
+func CancelHandler(app *execution.App) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		run, err := app.CancelRun(c.PathParam("id"))
+		if errors.Is(err, execution.ErrRunNotFound) {
+			return c.JSON(404, map[string]string{"error": err.Error()})
+		}
+		if errors.Is(err, execution.ErrNotCancellable) {
+			return c.JSON(409, map[string]string{"error": err.Error()})
+		}
+		if err != nil {
+			return c.JSON(500, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(200, run)
+	}
+}
@@ -1,6 +1,7 @@
 package run
 
 import (
+	"errors"
 	"regexp"
 	"strings"
 
@@ -25,59 +26,108 @@ func NewHandler(app *execution.App) echo.HandlerFunc {
 		if newrun.BenchmarkID == "" || newrun.Name == "" {
 			return c.JSON(400, map[string]string{"error": "missing required fields: benchmark_id, name"})
 		}
-		run := newrun.Run
+		// only re-runs refer to the run they were made from
+		newrun.SourceRunID = nil
+		if key := strings.TrimSpace(c.Request().Header.Get(IdempotencyHeader)); key != "" {
+			newrun.ExternalID = &key
+		}
+
+		return create(c, app, newrun.Run, newrun.GitHubPRLink, newrun.Supersede)
+	}
+}
+
+// create validates and queues the run and lets the PR know about it.
+func create(c echo.Context, app *execution.App, run models.Run, prLink string, supersede bool) error {
+	run.RefreshId()
+	run.RefreshCreated()
+	run.RefreshUpdated()
+	run.TriggeredAt = run.Created
+	run.Status = execution.StatusPending
+	// the queue order is only changed through the admin queue API
+	run.Priority = 0
+	run.Name = strings.ReplaceAll(strings.TrimSpace(run.Name), " ", "_")
+	if run.Origin != nil {
+		o := strings.TrimSpace(*run.Origin)
+		o = strings.ReplaceAll(o, " ", "_")
+		run.Origin = &o
+	}
 
-		run.RefreshId()
-		run.RefreshCreated()
-		run.RefreshUpdated()
-		run.TriggeredAt = run.Created
-		run.Status = "pending"
-		run.Name = strings.ReplaceAll(strings.TrimSpace(run.Name), " ", "_")
-		if run.Origin != nil {
-			o := strings.TrimSpace(*run.Origin)
-			o = strings.ReplaceAll(o, " ", "_")
-			run.Origin = &o
+	// Validate run name.
+	if !nameRegex.MatchString(run.Name) {
+		return c.JSON(400, map[string]string{
+			"error": "invalid name, should be alphanumeric, dot, dash, underscore",
+		})
+	}
+
+	// Validate run vars against the benchmark variables.
+	vars, err := execution.ParseVars(run.Vars)
+	if err != nil {
+		return c.JSON(400, map[string]string{"error": err.Error()})
+	}
+	if err := app.CheckRunVars(run.BenchmarkID, vars); err != nil {
+		if errors.Is(err, execution.ErrInspectVars) {
+			return c.JSON(500, map[string]string{"error": err.Error()})
 		}
+		return c.JSON(400, map[string]string{"error": err.Error()})
+	}
 
-		// Validate run name.
-		if !nameRegex.MatchString(run.Name) {
-			return c.JSON(400, map[string]string{
-				"error": "invalid name, should be alphanumeric, dot, dash, underscore",
-			})
+	// Runs may be pinned to an older script version.
+	if run.ScriptVersionID != nil && *run.ScriptVersionID != "" {
+		version, err := app.FindScriptVersion(*run.ScriptVersionID)
+		if err != nil || version.BenchmarkID != run.BenchmarkID {
+			return c.JSON(400, map[string]string{"error": "script version not found for this benchmark"})
 		}
+	}
 
-		if err := app.PB.DB().Model(&run).
-			Insert(
-				"Id", "BenchmarkID", "Name", "Origin", "Status", "Comment",
-				"Created", "Updated", "TriggeredAt", "Meta", "Vars",
-			); err != nil {
+	// Return the run created earlier with the same key instead of queueing
+	// a duplicate.
+	existing, err := insertOnce(app, &run)
+	if err != nil {
+		return c.JSON(500, map[string]string{"error": err.Error()})
+	}
+	if existing != nil {
+		return c.JSON(200, existing)
+	}
+	app.RecordRunEvent(run.Id, "", run.Status, execution.SourceAPI, "")
+
+	var grafanaURL string
+	if err := app.PB.DB().
+		Select("grafana_url").
+		From("benchmarks").
+		Where(dbx.HashExp{"id": run.BenchmarkID}).
+		Row(&grafanaURL); err != nil {
+		log.Error().Err(err).Msg("error getting benchmark")
+	}
+
+	comment := gh.InProgressCommentString(grafanaURL)
+	if supersede && prLink != "" {
+		superseded, err := app.SupersedeRuns(run, prLink)
+		if err != nil {
 			return c.JSON(500, map[string]string{"error": err.Error()})
 		}
-
-		var grafanaURL string
-		if err := app.PB.DB().
-			Select("grafana_url").
-			From("benchmarks").
-			Where(dbx.HashExp{"id": run.BenchmarkID}).
-			Row(&grafanaURL); err != nil {
-			log.Error().Err(err).Msg("error getting benchmark")
+		if len(superseded) > 0 {
+			names := []string{}
+			for _, r := range superseded {
+				names = append(names, r.Name)
+			}
+			comment += "\n" + gh.SupersededNoteString(names)
 		}
+	}
 
-		if newrun.GitHubPRLink != "" {
-			if prID, err := app.GH.AddOrUpdateComment(c.Request().Context(), newrun.GitHubPRLink, gh.InProgressCommentString(grafanaURL)); err != nil {
+	if prLink != "" {
+		if prID, err := app.GH.AddOrUpdateComment(c.Request().Context(), prLink, comment); err != nil {
+			return c.JSON(500, map[string]string{"error": err.Error()})
+		} else {
+			run.RefreshUpdated()
+			run.GitHubPRID = &prID
+			if err := app.PB.DB().Model(&run).
+				Update(
+					"GitHubPRID", "Updated",
+				); err != nil {
 				return c.JSON(500, map[string]string{"error": err.Error()})
-			} else {
-				run.RefreshUpdated()
-				run.GitHubPRID = &prID
-				if err := app.PB.DB().Model(&run).
-					Update(
-						"GitHubPRID", "Updated",
-					); err != nil {
-					return c.JSON(500, map[string]string{"error": err.Error()})
-				}
 			}
 		}
-
-		return c.JSON(201, run)
 	}
+
+	return c.JSON(201, run)
 }
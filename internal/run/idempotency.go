@@ -0,0 +1,74 @@
+package run
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/tools/types"
+	"github.com/spf13/viper"
+	"github.com/supabase/supabench/internal/execution"
+	"github.com/supabase/supabench/models"
+)
+
+// IdempotencyHeader lets clients safely retry run creation.
+const IdempotencyHeader = "Idempotency-Key"
+
+// idempotencyMu serializes the lookup and insert of runs with a key. It is
+// held for nothing else, so runs are still created concurrently.
+var idempotencyMu sync.Mutex
+
+// idempotencyWindow is how long a key is remembered, overridable with
+// SUPABENCH_IDEMPOTENCY_WINDOW.
+func idempotencyWindow() time.Duration {
+	if d := viper.GetDuration("IDEMPOTENCY_WINDOW"); d > 0 {
+		return d
+	}
+	return 24 * time.Hour
+}
+
+// insertOnce inserts the run unless a run with the same key was created
+// within the window, in which case that run is returned instead.
+func insertOnce(app *execution.App, run *models.Run) (*models.Run, error) {
+	if run.ExternalID != nil && *run.ExternalID != "" {
+		idempotencyMu.Lock()
+		defer idempotencyMu.Unlock()
+
+		existing, err := findByExternalID(app, run.BenchmarkID, *run.ExternalID)
+		if err != nil || existing != nil {
+			return existing, err
+		}
+	}
+
+	return nil, app.PB.DB().Model(run).
+		Insert(
+			"Id", "BenchmarkID", "Name", "Origin", "Status", "Comment",
+			"Created", "Updated", "TriggeredAt", "Meta", "Vars", "ScriptVersionID",
+			"SourceRunID", "Priority", "ExternalID", "DryRun",
+		)
+}
+
+// findByExternalID returns the run of the benchmark created with the key
+// within the retention window, or nil. Keys are scoped to the benchmark, so
+// the same key used for another benchmark creates a new run.
+func findByExternalID(app *execution.App, benchmarkID, key string) (*models.Run, error) {
+	since, err := types.ParseDateTime(time.Now().UTC().Add(-idempotencyWindow()))
+	if err != nil {
+		return nil, err
+	}
+
+	var run models.Run
+	if err := app.PB.DB().
+		Select().
+		Where(dbx.HashExp{"benchmark_id": benchmarkID, "external_id": key}).
+		AndWhere(dbx.NewExp("created >= {:since}", dbx.Params{"since": since.String()})).
+		OrderBy("created DESC").
+		One(&run); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &run, nil
+}
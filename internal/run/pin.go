@@ -0,0 +1,23 @@
+package run
+
+import (
+	"errors"
+
+	"github.com/labstack/echo/v5"
+	"github.com/supabase/supabench/internal/execution"
+)
+
+// PinHandler pins or unpins a run. Pinned runs, e.g. baselines, are never
+// compacted or deleted by retention.
+func PinHandler(app *execution.App, pinned bool) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		run, err := app.PinRun(c.PathParam("id"), pinned)
+		if errors.Is(err, execution.ErrRunNotFound) {
+			return c.JSON(404, map[string]string{"error": err.Error()})
+		}
+		if err != nil {
+			return c.JSON(500, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(200, run)
+	}
+}
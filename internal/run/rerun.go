@@ -0,0 +1,127 @@
+package run
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/labstack/echo/v5"
+	"github.com/pocketbase/dbx"
+	"github.com/supabase/supabench/internal/execution"
+	"github.com/supabase/supabench/models"
+)
+
+// rerunSuffixRegex matches the suffix added to the names of re-runs.
+var rerunSuffixRegex = regexp.MustCompile(`-r(\d+)$`)
+
+type rerunRequest struct {
+	// Name overrides the derived name of the new run.
+	Name string `json:"name"`
+	// Vars are merged on top of the vars of the source run.
+	Vars map[string]string `json:"vars"`
+	// OriginalScript pins the new run to the script version of the source run.
+	OriginalScript bool `json:"original_script"`
+}
+
+// RerunHandler queues a copy of an existing run.
+func RerunHandler(app *execution.App) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := rerunRequest{}
+		if c.Request().ContentLength != 0 {
+			if err := c.Echo().JSONSerializer.Deserialize(c, &req); err != nil {
+				return c.JSON(400, map[string]string{"error": err.Error()})
+			}
+		}
+
+		var source models.Run
+		if err := app.PB.DB().
+			Select().
+			Where(dbx.HashExp{"id": c.PathParam("id")}).
+			One(&source); err != nil {
+			if err == sql.ErrNoRows {
+				return c.JSON(404, map[string]string{"error": "run not found"})
+			}
+			return c.JSON(500, map[string]string{"error": err.Error()})
+		}
+
+		run := models.Run{
+			BenchmarkID: source.BenchmarkID,
+			Name:        req.Name,
+			Origin:      source.Origin,
+			Comment:     source.Comment,
+			Meta:        source.Meta,
+			SourceRunID: &source.Id,
+		}
+
+		if run.Name == "" {
+			name, err := rerunName(app, source)
+			if err != nil {
+				return c.JSON(500, map[string]string{"error": err.Error()})
+			}
+			run.Name = name
+		}
+
+		vars, err := execution.ParseVars(source.Vars)
+		if err != nil {
+			return c.JSON(400, map[string]string{"error": "source run: " + err.Error()})
+		}
+		for k, v := range req.Vars {
+			vars[k] = v
+		}
+		if len(vars) > 0 {
+			b, err := json.Marshal(vars)
+			if err != nil {
+				return c.JSON(500, map[string]string{"error": err.Error()})
+			}
+			v := string(b)
+			run.Vars = &v
+		}
+
+		if req.OriginalScript {
+			if source.ScriptVersionID == nil || *source.ScriptVersionID == "" {
+				return c.JSON(400, map[string]string{"error": "source run has no recorded script version"})
+			}
+			run.ScriptVersionID = source.ScriptVersionID
+		}
+
+		var prLink string
+		if source.GitHubPRID != nil && *source.GitHubPRID != "" {
+			if prLink, err = app.GH.GetPRLinkByID(*source.GitHubPRID); err != nil {
+				return c.JSON(500, map[string]string{"error": err.Error()})
+			}
+		}
+
+		return create(c, app, run, prLink, false)
+	}
+}
+
+// rerunName derives the name of a re-run from the source run name, e.g.
+// name -> name-r2 -> name-r3.
+func rerunName(app *execution.App, source models.Run) (string, error) {
+	base := rerunSuffixRegex.ReplaceAllString(source.Name, "")
+
+	var names []string
+	if err := app.PB.DB().
+		Select("name").
+		From("runs").
+		Where(dbx.HashExp{"benchmark_id": source.BenchmarkID}).
+		AndWhere(dbx.Like("name", base+"-r").Match(false, true)).
+		Column(&names); err != nil {
+		return "", err
+	}
+
+	next := 2
+	for _, name := range names {
+		m := rerunSuffixRegex.FindStringSubmatch(name)
+		if m == nil || name[:len(name)-len(m[0])] != base {
+			continue
+		}
+		if n, err := strconv.Atoi(m[1]); err == nil && n >= next {
+			next = n + 1
+		}
+	}
+
+	return fmt.Sprintf("%s-r%d", base, next), nil
+}
@@ -0,0 +1,149 @@
+// Package summary reads the k6 end-of-test summary that loaders store in
+// the raw data of runs.
+package summary
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type metric struct {
+	Type       string             `json:"type,omitempty"`
+	Contains   string             `json:"contains,omitempty"`
+	Values     map[string]float64 `json:"values"`
+	Thresholds map[string]struct {
+		OK bool `json:"ok"`
+	} `json:"thresholds,omitempty"`
+}
+
+type summary struct {
+	Metrics map[string]metric `json:"metrics"`
+}
+
+func parse(raw []byte) summary {
+	var s summary
+	if len(raw) > 0 {
+		_ = json.Unmarshal(raw, &s)
+	}
+	return s
+}
+
+// Values flattens the summary metrics into "metric.stat" values, e.g.
+// http_req_duration.p(95).
+func Values(raw []byte) map[string]float64 {
+	values := map[string]float64{}
+	for name, m := range parse(raw).Metrics {
+		for stat, v := range m.Values {
+			values[name+"."+stat] = v
+		}
+	}
+	return values
+}
+
+// FailedThresholds returns the k6 thresholds the run did not meet.
+func FailedThresholds(raw []byte) []string {
+	failed := []string{}
+	for name, m := range parse(raw).Metrics {
+		for expr, t := range m.Thresholds {
+			if !t.OK {
+				failed = append(failed, name+": "+expr)
+			}
+		}
+	}
+	sort.Strings(failed)
+	return failed
+}
+
+// Compact drops everything but the metrics from the summary. The top level
+// keys the given JSONPaths point into, like an extract_metric_path, are
+// kept as well.
+func Compact(raw []byte, paths ...string) ([]byte, error) {
+	doc := map[string]json.RawMessage{}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+
+	compact := map[string]interface{}{}
+	if _, ok := doc["metrics"]; ok {
+		compact["metrics"] = parse(raw).Metrics
+	}
+	for _, path := range paths {
+		keys, err := splitPath(path)
+		if err != nil || len(keys) == 0 || keys[0] == "metrics" {
+			continue
+		}
+		if v, ok := doc[keys[0]]; ok {
+			compact[keys[0]] = v
+		}
+	}
+	return json.Marshal(compact)
+}
+
+// Lookup evaluates the subset of JSONPath used for extract_metric_path,
+// e.g. $.metrics.http_req_duration.values['p(95)'], against raw.
+func Lookup(raw []byte, path string) (float64, error) {
+	var doc interface{}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return 0, fmt.Errorf("raw data: %w", err)
+	}
+
+	keys, err := splitPath(path)
+	if err != nil {
+		return 0, err
+	}
+	for _, key := range keys {
+		switch v := doc.(type) {
+		case map[string]interface{}:
+			doc = v[key]
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(v) {
+				return 0, fmt.Errorf("%s: no element %s", path, key)
+			}
+			doc = v[i]
+		default:
+			return 0, fmt.Errorf("%s: no field %s", path, key)
+		}
+	}
+
+	switch v := doc.(type) {
+	case float64:
+		return v, nil
+	case string:
+		return strconv.ParseFloat(v, 64)
+	}
+	return 0, fmt.Errorf("%s is not a number", path)
+}
+
+func splitPath(path string) ([]string, error) {
+	p := strings.TrimPrefix(strings.TrimSpace(path), "$")
+	keys := []string{}
+	for p != "" {
+		switch p[0] {
+		case '.':
+			p = p[1:]
+			end := strings.IndexAny(p, ".[")
+			if end < 0 {
+				end = len(p)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("invalid metric path %q", path)
+			}
+			keys = append(keys, p[:end])
+			p = p[end:]
+		case '[':
+			end := strings.IndexByte(p, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid metric path %q", path)
+			}
+			keys = append(keys, strings.Trim(p[1:end], `'"`))
+			p = p[end+1:]
+		default:
+			return nil, fmt.Errorf("invalid metric path %q", path)
+		}
+	}
+	return keys, nil
+}
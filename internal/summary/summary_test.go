@@ -0,0 +1,125 @@
+package summary
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const raw = `{
+	"metrics": {
+		"http_req_duration": {"type": "trend", "contains": "time", "values": {"avg": 51.5, "p(95)": 81}, "thresholds": {"p(95)<100": {"ok": true}}},
+		"http_req_failed": {"type": "rate", "values": {"rate": 0.02}, "thresholds": {"rate<0.01": {"ok": false}}},
+		"vus": {"type": "gauge", "values": {"value": 10}}
+	},
+	"root_group": {"name": "", "checks": [{"name": "status is 200", "passes": 99}]},
+	"setup_data": {"rps": "100", "regions": [{"name": "eu", "latency": 12.5}]},
+	"state": {"testRunDurationMs": 60000}
+}`
+
+func TestValues(t *testing.T) {
+	want := map[string]float64{
+		"http_req_duration.avg":   51.5,
+		"http_req_duration.p(95)": 81,
+		"http_req_failed.rate":    0.02,
+		"vus.value":               10,
+	}
+	if got := Values([]byte(raw)); !reflect.DeepEqual(got, want) {
+		t.Errorf("Values() = %v, want %v", got, want)
+	}
+	if got := Values([]byte("not json")); len(got) != 0 {
+		t.Errorf("Values() = %v, want none for invalid raw data", got)
+	}
+}
+
+func TestFailedThresholds(t *testing.T) {
+	want := []string{"http_req_failed: rate<0.01"}
+	if got := FailedThresholds([]byte(raw)); !reflect.DeepEqual(got, want) {
+		t.Errorf("FailedThresholds() = %v, want %v", got, want)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	tests := []struct {
+		path    string
+		want    float64
+		wantErr string
+	}{
+		{path: "$.metrics.http_req_duration.values['p(95)']", want: 81},
+		{path: `$.metrics.http_req_duration.values["avg"]`, want: 51.5},
+		{path: "$.metrics.vus.values.value", want: 10},
+		{path: "$.setup_data.rps", want: 100},
+		{path: "$.setup_data.regions[0].latency", want: 12.5},
+		{path: "$.setup_data.regions[1].latency", wantErr: "no element 1"},
+		{path: "$.metrics.vus.values.value.x", wantErr: "no field x"},
+		{path: "$.root_group.name", wantErr: "invalid syntax"},
+		{path: "$.metrics.vus", wantErr: "is not a number"},
+		{path: "$.metrics.missing.values.avg", wantErr: "no field values"},
+		{path: "$..metrics", wantErr: "invalid metric path"},
+		{path: "$.metrics[vus", wantErr: "invalid metric path"},
+		{path: "metrics", wantErr: "invalid metric path"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, err := Lookup([]byte(raw), tt.path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Lookup() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Lookup() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Lookup() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompact(t *testing.T) {
+	tests := []struct {
+		name     string
+		raw      string
+		paths    []string
+		wantKeys []string
+		wantErr  bool
+	}{
+		{name: "metrics only", raw: raw, wantKeys: []string{"metrics"}},
+		{name: "extract path kept", raw: raw, paths: []string{"$.setup_data.rps"}, wantKeys: []string{"metrics", "setup_data"}},
+		{name: "metrics path", raw: raw, paths: []string{"$.metrics.vus.values.value"}, wantKeys: []string{"metrics"}},
+		{name: "missing and invalid paths", raw: raw, paths: []string{"$.nothing", "nope"}, wantKeys: []string{"metrics"}},
+		{name: "no metrics", raw: `{"state":{}}`, wantKeys: []string{}},
+		{name: "not json", raw: `k6 crashed`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Compact([]byte(tt.raw), tt.paths...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Compact() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			for _, key := range []string{"metrics", "root_group", "setup_data", "state"} {
+				want := false
+				for _, k := range tt.wantKeys {
+					want = want || k == key
+				}
+				if has := strings.Contains(string(got), `"`+key+`"`); has != want {
+					t.Errorf("Compact() = %s, want %s kept: %v", got, key, want)
+				}
+			}
+			// the metrics survive compaction unchanged
+			if len(tt.wantKeys) > 0 && tt.wantKeys[0] == "metrics" && !reflect.DeepEqual(Values(got), Values([]byte(tt.raw))) {
+				t.Errorf("Values(Compact()) = %v, want %v", Values(got), Values([]byte(tt.raw)))
+			}
+			if tt.raw == raw && !reflect.DeepEqual(FailedThresholds(got), FailedThresholds([]byte(raw))) {
+				t.Errorf("FailedThresholds(Compact()) = %v, want thresholds kept", FailedThresholds(got))
+			}
+		})
+	}
+}
@@ -3,15 +3,26 @@ package terraform
 import (
 	"context"
 	"fmt"
+	"sync"
 
 	"github.com/hashicorp/terraform-exec/tfexec"
+	tfjson "github.com/hashicorp/terraform-json"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/viper"
+	"github.com/supabase/supabench/internal/redact"
 )
 
 type TfExec struct {
-	execPath string
-	opts     Options
+	bins *Binaries
+	opts Options
+
+	cliOnce sync.Once
+	cliPath string
+	cliErr  error
+
+	// initMu serializes init, the plugin cache it installs providers into
+	// is not safe for concurrent use.
+	initMu sync.Mutex
 }
 
 type Options struct {
@@ -23,19 +34,26 @@ type Options struct {
 	PrivateKeyLocation string
 	AWSAccessKeyID     string
 	AWSSecretAccessKey string
+
+	PluginCacheDir string
+	ProviderMirror string
+	MirrorOnly     bool
 }
 
 type tfLog struct {
-	cmd string
+	cmd    string
+	redact *redact.Redactor
 }
 
 func (t *tfLog) Printf(format string, v ...interface{}) {
-	log.Debug().Str("cmd", t.cmd).Msgf(format, v...)
+	log.Debug().Str("cmd", t.cmd).Msg(t.redact.String(fmt.Sprintf(format, v...)))
 }
 
-func New(path string) *TfExec {
+func New(bins *Binaries) *TfExec {
+	viper.SetDefault("PLUGIN_CACHE_DIR", "pb_data/terraform/plugin-cache")
+
 	return &TfExec{
-		execPath: path,
+		bins: bins,
 		opts: Options{
 			SupabenchToken:     viper.GetString("TOKEN"),
 			SupabenchURI:       viper.GetString("URI"),
@@ -43,41 +61,84 @@ func New(path string) *TfExec {
 			PrivateKeyLocation: viper.GetString("PRIVATE_KEY_LOCATION"),
 			AWSAccessKeyID:     viper.GetString("AWS_ACCESS_KEY_ID"),
 			AWSSecretAccessKey: viper.GetString("AWS_SECRET_ACCESS_KEY"),
+			PluginCacheDir:     viper.GetString("PLUGIN_CACHE_DIR"),
+			ProviderMirror:     viper.GetString("PROVIDER_MIRROR"),
+			MirrorOnly:         viper.GetBool("PROVIDER_MIRROR_ONLY"),
 		},
 	}
 }
 
-func (tf *TfExec) Apply(wd string, envs, benchVars map[string]string) error {
-	exec, err := tfexec.NewTerraform(wd, tf.execPath)
+// terraform returns an executor for wd that uses the binary the module
+// requires.
+func (tf *TfExec) terraform(ctx context.Context, wd string) (*tfexec.Terraform, error) {
+	execPath, err := tf.bins.ForModule(ctx, wd)
+	if err != nil {
+		return nil, err
+	}
+	return tfexec.NewTerraform(wd, execPath)
+}
+
+// Secrets returns the values supabench itself injects into every run.
+func (tf *TfExec) Secrets() []string {
+	return []string{
+		tf.opts.SupabenchToken,
+		tf.opts.FlyAccessToken,
+		tf.opts.AWSAccessKeyID,
+		tf.opts.AWSSecretAccessKey,
+	}
+}
+
+// Init installs the providers and modules of the configuration in wd.
+func (tf *TfExec) Init(ctx context.Context, wd string, opts ExecOptions) error {
+	exec, err := tf.terraform(ctx, wd)
+	if err != nil {
+		return err
+	}
+
+	env, err := tf.initEnv()
 	if err != nil {
 		return err
 	}
+	if err = exec.SetEnv(env); err != nil {
+		return err
+	}
 
+	// providers are installed as pinned by the lock file, if there is one
 	log.Info().Str("path", wd).Msg("init terraform")
-	if err = exec.Init(context.Background(), tfexec.Upgrade(true)); err != nil {
+	tf.initMu.Lock()
+	defer tf.initMu.Unlock()
+	return countError("init", exec.Init(ctx, append(opts.initOptions(), tfexec.Upgrade(false))...))
+}
+
+// Apply applies the configuration in wd, which has to be initialized first.
+func (tf *TfExec) Apply(ctx context.Context, wd string, envs, benchVars map[string]string, opts ExecOptions, r *redact.Redactor) error {
+	exec, err := tf.terraform(ctx, wd)
+	if err != nil {
 		return err
 	}
+
 	if err = exec.SetEnv(tf.enrichEnv(envs)); err != nil {
 		return err
 	}
 	vars := []tfexec.ApplyOption{}
-	for k, v := range tf.enrichVars(benchVars) {
+	for k, v := range tf.moduleVars(wd, benchVars) {
 		vars = append(vars, tfexec.Var(fmt.Sprintf("%s=%s", k, v)))
 	}
 
 	log.Info().Str("path", wd).Msg("applying terraform")
 	logger := tfLog{
-		cmd: "terraform apply",
+		cmd:    "terraform apply",
+		redact: r,
 	}
 	exec.SetLogger(&logger)
 	// exec.SetStderr(os.Stderr)
 	// exec.SetStdout(os.Stdout)
-	vars = append(vars, tfexec.Parallelism(25))
-	return exec.Apply(context.Background(), vars...)
+	vars = append(vars, opts.applyOptions()...)
+	return countError("apply", exec.Apply(ctx, vars...))
 }
 
-func (tf *TfExec) Destroy(wd string, envs, benchVars map[string]string) error {
-	exec, err := tfexec.NewTerraform(wd, tf.execPath)
+func (tf *TfExec) Destroy(wd string, envs, benchVars map[string]string, opts ExecOptions, r *redact.Redactor) error {
+	exec, err := tf.terraform(context.Background(), wd)
 	if err != nil {
 		return err
 	}
@@ -86,19 +147,55 @@ func (tf *TfExec) Destroy(wd string, envs, benchVars map[string]string) error {
 		return err
 	}
 	vars := []tfexec.DestroyOption{}
-	for k, v := range tf.enrichVars(benchVars) {
+	for k, v := range tf.moduleVars(wd, benchVars) {
 		vars = append(vars, tfexec.Var(fmt.Sprintf("%s=%s", k, v)))
 	}
 
 	log.Info().Str("path", wd).Msg("destroying terraform")
 	logger := tfLog{
-		cmd: "terraform destroy",
+		cmd:    "terraform destroy",
+		redact: r,
 	}
 	exec.SetLogger(&logger)
 	// exec.SetStderr(os.Stderr)
 	// exec.SetStdout(os.Stdout)
-	vars = append(vars, tfexec.Parallelism(25))
-	return exec.Destroy(context.Background(), vars...)
+	vars = append(vars, opts.destroyOptions()...)
+	return countError("destroy", exec.Destroy(context.Background(), vars...))
+}
+
+// Validate initializes the module in wd without a backend and validates it.
+func (tf *TfExec) Validate(wd string) (*tfjson.ValidateOutput, error) {
+	exec, err := tf.terraform(context.Background(), wd)
+	if err != nil {
+		return nil, err
+	}
+
+	env, err := tf.initEnv()
+	if err != nil {
+		return nil, err
+	}
+	if err = exec.SetEnv(env); err != nil {
+		return nil, err
+	}
+
+	log.Info().Str("path", wd).Msg("validating terraform")
+	tf.initMu.Lock()
+	err = exec.Init(context.Background(), tfexec.Backend(false))
+	tf.initMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return exec.Validate(context.Background())
+}
+
+// InjectedVars returns the names of the variables supabench sets on every
+// run.
+func (tf *TfExec) InjectedVars() []string {
+	names := []string{}
+	for k := range tf.enrichVars(map[string]string{}) {
+		names = append(names, k)
+	}
+	return names
 }
 
 func (tf *TfExec) enrichVars(vars map[string]string) map[string]string {
@@ -111,11 +208,27 @@ func (tf *TfExec) enrichVars(vars map[string]string) map[string]string {
 	return vars
 }
 
+// moduleVars adds the injected vars to benchVars, leaving out the ones a
+// module in wd does not declare, e.g. a shared environment module.
+func (tf *TfExec) moduleVars(wd string, benchVars map[string]string) map[string]string {
+	vars := tf.enrichVars(benchVars)
+	declared := DeclaredOnly(wd, vars)
+	for _, k := range tf.InjectedVars() {
+		if _, ok := declared[k]; !ok {
+			delete(vars, k)
+		}
+	}
+	return vars
+}
+
 func (tf *TfExec) enrichEnv(env map[string]string) map[string]string {
 	env["AWS_ACCESS_KEY_ID"] = tf.opts.AWSAccessKeyID
 	env["AWS_SECRET_ACCESS_KEY"] = tf.opts.AWSSecretAccessKey
 	env["SUPABENCH_TOKEN"] = tf.opts.SupabenchToken
 	env["SUPABENCH_URI"] = tf.opts.SupabenchURI
+	if path, err := tf.cliConfig(); err == nil {
+		env[cliConfigEnv] = path
+	}
 
 	return env
 }
@@ -0,0 +1,358 @@
+package terraform
+
+import (
+	"archive/zip"
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/go-version"
+	"github.com/hashicorp/hc-install/product"
+	"github.com/hashicorp/hc-install/releases"
+	"github.com/hashicorp/terraform-config-inspect/tfconfig"
+	"github.com/hashicorp/terraform-exec/tfexec"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+	"golang.org/x/sync/singleflight"
+)
+
+// Products that can execute benchmark scripts.
+const (
+	ProductTerraform = "terraform"
+	ProductOpenTofu  = "opentofu"
+)
+
+// DefaultVersions are used for scripts that do not set required_version,
+// per product since OpenTofu versions start at 1.6.
+var DefaultVersions = map[string]string{
+	ProductTerraform: "1.2.6",
+	ProductOpenTofu:  "1.6.2",
+}
+
+const tofuReleasesURL = "https://github.com/opentofu/opentofu/releases/download"
+
+// Binaries finds the terraform binary to execute a module with. Binaries
+// are looked up in the configured path and the cache dir, and downloaded
+// into the cache dir only when needed, so that supabench starts offline.
+type Binaries struct {
+	Product        string
+	Path           string
+	CacheDir       string
+	DefaultVersion string
+	Download       bool
+
+	mu       sync.Mutex
+	versions map[string]*version.Version
+	installs singleflight.Group
+}
+
+// NewBinaries configures binaries with SUPABENCH_TERRAFORM_PRODUCT,
+// SUPABENCH_TERRAFORM_PATH, SUPABENCH_TERRAFORM_CACHE_DIR,
+// SUPABENCH_TERRAFORM_VERSION and SUPABENCH_TERRAFORM_DOWNLOAD.
+func NewBinaries() *Binaries {
+	viper.SetDefault("TERRAFORM_PRODUCT", ProductTerraform)
+	viper.SetDefault("TERRAFORM_CACHE_DIR", "pb_data/terraform/bin")
+	viper.SetDefault("TERRAFORM_VERSION", DefaultVersions[viper.GetString("TERRAFORM_PRODUCT")])
+	viper.SetDefault("TERRAFORM_DOWNLOAD", true)
+
+	return &Binaries{
+		Product:        viper.GetString("TERRAFORM_PRODUCT"),
+		Path:           viper.GetString("TERRAFORM_PATH"),
+		CacheDir:       viper.GetString("TERRAFORM_CACHE_DIR"),
+		DefaultVersion: viper.GetString("TERRAFORM_VERSION"),
+		Download:       viper.GetBool("TERRAFORM_DOWNLOAD"),
+		versions:       map[string]*version.Version{},
+	}
+}
+
+// ForModule returns the binary for the module in dir, honouring its
+// required_version.
+func (b *Binaries) ForModule(ctx context.Context, dir string) (string, error) {
+	constraints := []string{}
+	if tfconfig.IsModuleDir(dir) {
+		if module, diags := tfconfig.LoadModule(dir); !diags.HasErrors() {
+			constraints = module.RequiredCore
+		}
+	}
+	return b.Find(ctx, strings.Join(constraints, ","))
+}
+
+// Find returns a binary matching the version constraint, or the default
+// version if there is no constraint. Concurrent lookups only wait for each
+// other when they need the same version installed.
+func (b *Binaries) Find(ctx context.Context, constraint string) (string, error) {
+	if constraint == "" {
+		constraint = "= " + b.DefaultVersion
+	}
+	c, err := version.NewConstraint(constraint)
+	if err != nil {
+		return "", fmt.Errorf("invalid required_version %q: %w", constraint, err)
+	}
+
+	if b.Path != "" {
+		v, err := b.version(ctx, b.Path)
+		if err != nil {
+			return "", err
+		}
+		if c.Check(v) {
+			return b.Path, nil
+		}
+	}
+
+	if path := b.cached(c); path != "" {
+		return path, nil
+	}
+
+	if !b.Download {
+		return "", fmt.Errorf("no %s binary matching %q is available and downloads are disabled", b.Product, constraint)
+	}
+	v, err := b.resolve(ctx, c, constraint)
+	if err != nil {
+		return "", err
+	}
+	path, err, _ := b.installs.Do(v.String(), func() (interface{}, error) {
+		if _, err := os.Stat(b.binaryPath(v)); err == nil {
+			return b.binaryPath(v), nil
+		}
+		return b.install(ctx, v)
+	})
+	if err != nil {
+		return "", err
+	}
+	return path.(string), nil
+}
+
+// version returns the version of the binary at path.
+func (b *Binaries) version(ctx context.Context, path string) (*version.Version, error) {
+	b.mu.Lock()
+	v, ok := b.versions[path]
+	b.mu.Unlock()
+	if ok {
+		return v, nil
+	}
+	exec, err := tfexec.NewTerraform(os.TempDir(), path)
+	if err != nil {
+		return nil, err
+	}
+	v, _, err = exec.Version(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+	b.mu.Lock()
+	b.versions[path] = v
+	b.mu.Unlock()
+	return v, nil
+}
+
+// cached returns the newest cached binary matching the constraints.
+func (b *Binaries) cached(c version.Constraints) string {
+	entries, err := os.ReadDir(b.productDir())
+	if err != nil {
+		return ""
+	}
+
+	versions := version.Collection{}
+	for _, e := range entries {
+		v, err := version.NewVersion(e.Name())
+		if err != nil || !c.Check(v) {
+			continue
+		}
+		if _, err := os.Stat(b.binaryPath(v)); err == nil {
+			versions = append(versions, v)
+		}
+	}
+	if len(versions) == 0 {
+		return ""
+	}
+	sort.Sort(versions)
+	return b.binaryPath(versions[len(versions)-1])
+}
+
+// resolve returns the newest released version matching the constraints.
+func (b *Binaries) resolve(ctx context.Context, c version.Constraints, constraint string) (*version.Version, error) {
+	switch b.Product {
+	case ProductTerraform:
+		list, err := (&releases.Versions{Product: product.Terraform, Constraints: c}).List(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if len(list) == 0 {
+			return nil, fmt.Errorf("no terraform release matches %q", constraint)
+		}
+		return list[len(list)-1].(*releases.ExactVersion).Version, nil
+	case ProductOpenTofu:
+		// OpenTofu releases can not be listed, only exact versions are
+		// downloaded
+		v, err := version.NewVersion(strings.TrimPrefix(strings.TrimSpace(constraint), "="))
+		if err != nil {
+			return nil, fmt.Errorf("opentofu %q is not cached, only exact versions can be downloaded", constraint)
+		}
+		return v, nil
+	default:
+		return nil, fmt.Errorf("unknown terraform product %q", b.Product)
+	}
+}
+
+// install downloads version v into the cache dir.
+func (b *Binaries) install(ctx context.Context, v *version.Version) (string, error) {
+	dir := filepath.Dir(b.binaryPath(v))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	log.Info().Str("product", b.Product).Str("version", v.String()).Msg("installing terraform")
+
+	if b.Product == ProductOpenTofu {
+		if err := installTofu(ctx, v, dir); err != nil {
+			return "", err
+		}
+		return b.binaryPath(v), nil
+	}
+	return (&releases.ExactVersion{
+		Product:    product.Terraform,
+		Version:    v,
+		InstallDir: dir,
+	}).Install(ctx)
+}
+
+func (b *Binaries) productDir() string {
+	return filepath.Join(b.CacheDir, b.Product)
+}
+
+func (b *Binaries) binaryPath(v *version.Version) string {
+	name := "terraform"
+	if b.Product == ProductOpenTofu {
+		name = "tofu"
+	}
+	return filepath.Join(b.productDir(), v.String(), name)
+}
+
+// installTofu downloads the OpenTofu release zip, verifies its checksum and
+// unpacks the binary into dir.
+func installTofu(ctx context.Context, v *version.Version, dir string) error {
+	name := fmt.Sprintf("tofu_%s_%s_%s.zip", v, runtime.GOOS, runtime.GOARCH)
+	base := fmt.Sprintf("%s/v%s/", tofuReleasesURL, v)
+
+	sums, err := download(ctx, base+fmt.Sprintf("tofu_%s_SHA256SUMS", v))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(sums)
+	want, err := checksum(sums, name)
+	if err != nil {
+		return err
+	}
+
+	archive, err := download(ctx, base+name)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(archive)
+	if got, err := fileSHA256(archive); err != nil {
+		return err
+	} else if got != want {
+		return fmt.Errorf("checksum mismatch for %s", name)
+	}
+
+	zr, err := zip.OpenReader(archive)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	for _, f := range zr.File {
+		if f.Name != "tofu" {
+			continue
+		}
+		src, err := f.Open()
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		// unpack next to the binary and rename, so that cached never
+		// returns a partially written binary
+		tmp := filepath.Join(dir, "tofu.tmp")
+		dst, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0700)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(dst, src); err != nil {
+			dst.Close()
+			return err
+		}
+		if err := dst.Close(); err != nil {
+			return err
+		}
+		return os.Rename(tmp, filepath.Join(dir, "tofu"))
+	}
+	return errors.New("tofu binary not found in release archive")
+}
+
+func download(ctx context.Context, url string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("error downloading %s: %s", url, resp.Status)
+	}
+
+	f, err := os.CreateTemp("", "supabench-download-")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := io.Copy(f, resp.Body); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+func checksum(sumsPath, name string) (string, error) {
+	f, err := os.Open(sumsPath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[1] == name {
+			return fields[0], nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("no checksum for %s", name)
+}
+
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
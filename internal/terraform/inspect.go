@@ -0,0 +1,117 @@
+package terraform
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/terraform-config-inspect/tfconfig"
+)
+
+// Variable is a variable declared by a benchmark's root module.
+type Variable struct {
+	Name        string      `json:"name"`
+	Type        string      `json:"type"`
+	Description string      `json:"description"`
+	Default     interface{} `json:"default"`
+	Required    bool        `json:"required"`
+	Sensitive   bool        `json:"sensitive"`
+}
+
+// Variables parses the root module in dir and returns its variables sorted
+// by name.
+func Variables(dir string) ([]Variable, error) {
+	if !tfconfig.IsModuleDir(dir) {
+		return nil, errors.New("no terraform configuration files found")
+	}
+
+	module, diags := tfconfig.LoadModule(dir)
+	if diags.HasErrors() {
+		return nil, diags.Err()
+	}
+
+	vars := make([]Variable, 0, len(module.Variables))
+	for _, v := range module.Variables {
+		vars = append(vars, Variable{
+			Name:        v.Name,
+			Type:        v.Type,
+			Description: v.Description,
+			Default:     v.Default,
+			Required:    v.Required,
+			Sensitive:   v.Sensitive,
+		})
+	}
+	sort.Slice(vars, func(i, j int) bool {
+		return vars[i].Name < vars[j].Name
+	})
+
+	return vars, nil
+}
+
+// DeclaredOnly drops the vars the root module in dir does not declare. The
+// vars are returned unchanged if the module cannot be inspected.
+func DeclaredOnly(dir string, vars map[string]string) map[string]string {
+	declared, err := Variables(dir)
+	if err != nil {
+		return vars
+	}
+	names := map[string]bool{}
+	for _, v := range declared {
+		names[v.Name] = true
+	}
+
+	filtered := map[string]string{}
+	for k, v := range vars {
+		if names[k] {
+			filtered[k] = v
+		}
+	}
+	return filtered
+}
+
+// Check reports whether value, as passed with -var, matches the declared
+// type of the variable. Complex types are only checked to be valid HCL.
+func (v Variable) Check(value string) error {
+	switch t := strings.TrimSpace(v.Type); t {
+	case "", "any", "string":
+		return nil
+	case "number":
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return fmt.Errorf("variable %s must be a number", v.Name)
+		}
+	case "bool":
+		if value != "true" && value != "false" {
+			return fmt.Errorf("variable %s must be true or false", v.Name)
+		}
+	default:
+		if _, diags := hclsyntax.ParseExpression([]byte(value), v.Name, hcl.InitialPos); diags.HasErrors() {
+			return fmt.Errorf("variable %s must be a valid %s value", v.Name, t)
+		}
+	}
+	return nil
+}
+
+// IsModuleDir reports whether dir contains terraform configuration files.
+func IsModuleDir(dir string) bool {
+	return tfconfig.IsModuleDir(dir)
+}
+
+// OutputNames parses the root module in dir and returns the names of its
+// outputs.
+func OutputNames(dir string) ([]string, error) {
+	module, diags := tfconfig.LoadModule(dir)
+	if diags.HasErrors() {
+		return nil, diags.Err()
+	}
+
+	names := make([]string, 0, len(module.Outputs))
+	for name := range module.Outputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
@@ -0,0 +1,19 @@
+package terraform
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var commandErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "supabench_terraform_errors_total",
+	Help: "Terraform commands that failed.",
+}, []string{"command"})
+
+// countError counts the error of a terraform command, if any.
+func countError(command string, err error) error {
+	if err != nil {
+		commandErrors.WithLabelValues(command).Inc()
+	}
+	return err
+}
@@ -0,0 +1,132 @@
+package terraform
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-exec/tfexec"
+)
+
+// defaultParallelism is used unless a benchmark sets its own.
+const defaultParallelism = 25
+
+// ExecOptions are the terraform CLI options a benchmark can set in the
+// "terraform" key of its meta. Only these options are supported.
+type ExecOptions struct {
+	// Parallelism limits concurrent operations, -parallelism.
+	Parallelism int `json:"parallelism,omitempty"`
+	// Targets limits apply and plan to the given resources, -target.
+	// Destroy always destroys the whole state, a targeted apply creates the
+	// dependencies of the targets as well.
+	Targets []string `json:"targets,omitempty"`
+	// Refresh set to false skips refreshing the state, -refresh=false.
+	Refresh *bool `json:"refresh,omitempty"`
+	// LockTimeout is how long to retry acquiring the state lock,
+	// -lock-timeout.
+	LockTimeout string `json:"lock_timeout,omitempty"`
+	// BackendConfig is passed to init, -backend-config.
+	BackendConfig map[string]string `json:"backend_config,omitempty"`
+}
+
+// ParseExecOptions decodes and validates executor options. Unknown options
+// are rejected.
+func ParseExecOptions(raw []byte) (ExecOptions, error) {
+	var opts ExecOptions
+	if len(bytes.TrimSpace(raw)) == 0 || string(bytes.TrimSpace(raw)) == "null" {
+		return opts, nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&opts); err != nil {
+		return opts, fmt.Errorf("invalid terraform options: %w", err)
+	}
+	return opts, opts.Validate()
+}
+
+// Validate checks the option values.
+func (o ExecOptions) Validate() error {
+	if o.Parallelism < 0 || o.Parallelism > 256 {
+		return errors.New("invalid terraform options: parallelism must be between 1 and 256")
+	}
+	for _, t := range o.Targets {
+		if strings.TrimSpace(t) == "" {
+			return errors.New("invalid terraform options: empty target")
+		}
+	}
+	if o.LockTimeout != "" {
+		if _, err := time.ParseDuration(o.LockTimeout); err != nil {
+			return fmt.Errorf("invalid terraform options: lock_timeout: %w", err)
+		}
+	}
+	for k := range o.BackendConfig {
+		if strings.TrimSpace(k) == "" || strings.Contains(k, "=") {
+			return fmt.Errorf("invalid terraform options: backend_config key %q", k)
+		}
+	}
+	return nil
+}
+
+func (o ExecOptions) parallelism() int {
+	if o.Parallelism > 0 {
+		return o.Parallelism
+	}
+	return defaultParallelism
+}
+
+func (o ExecOptions) initOptions() []tfexec.InitOption {
+	opts := []tfexec.InitOption{}
+	keys := make([]string, 0, len(o.BackendConfig))
+	for k := range o.BackendConfig {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		opts = append(opts, tfexec.BackendConfig(k+"="+o.BackendConfig[k]))
+	}
+	return opts
+}
+
+func (o ExecOptions) applyOptions() []tfexec.ApplyOption {
+	opts := []tfexec.ApplyOption{tfexec.Parallelism(o.parallelism())}
+	for _, t := range o.Targets {
+		opts = append(opts, tfexec.Target(t))
+	}
+	if o.Refresh != nil {
+		opts = append(opts, tfexec.Refresh(*o.Refresh))
+	}
+	if o.LockTimeout != "" {
+		opts = append(opts, tfexec.LockTimeout(o.LockTimeout))
+	}
+	return opts
+}
+
+func (o ExecOptions) destroyOptions() []tfexec.DestroyOption {
+	opts := []tfexec.DestroyOption{tfexec.Parallelism(o.parallelism())}
+	if o.Refresh != nil {
+		opts = append(opts, tfexec.Refresh(*o.Refresh))
+	}
+	if o.LockTimeout != "" {
+		opts = append(opts, tfexec.LockTimeout(o.LockTimeout))
+	}
+	return opts
+}
+
+func (o ExecOptions) planOptions() []tfexec.PlanOption {
+	opts := []tfexec.PlanOption{tfexec.Parallelism(o.parallelism())}
+	for _, t := range o.Targets {
+		opts = append(opts, tfexec.Target(t))
+	}
+	if o.Refresh != nil {
+		opts = append(opts, tfexec.Refresh(*o.Refresh))
+	}
+	if o.LockTimeout != "" {
+		opts = append(opts, tfexec.LockTimeout(o.LockTimeout))
+	}
+	return opts
+}
@@ -0,0 +1,73 @@
+package terraform
+
+import (
+	"context"
+	"encoding/json"
+
+	tfjson "github.com/hashicorp/terraform-json"
+)
+
+// Output is a root module output read from the state.
+type Output struct {
+	Value     string `json:"value"`
+	Sensitive bool   `json:"sensitive"`
+}
+
+// Outputs reads the outputs of the applied configuration in wd. String
+// values are returned as is, other values as JSON.
+func (tf *TfExec) Outputs(ctx context.Context, wd string) (map[string]Output, error) {
+	exec, err := tf.terraform(ctx, wd)
+	if err != nil {
+		return nil, err
+	}
+
+	meta, err := exec.Output(ctx)
+	if err != nil {
+		return nil, countError("output", err)
+	}
+
+	outputs := map[string]Output{}
+	for name, o := range meta {
+		value := string(o.Value)
+		var s string
+		if err := json.Unmarshal(o.Value, &s); err == nil {
+			value = s
+		}
+		outputs[name] = Output{Value: value, Sensitive: o.Sensitive}
+	}
+	return outputs, nil
+}
+
+// StateResources returns the addresses of the managed resources in the
+// state of the configuration in wd.
+func (tf *TfExec) StateResources(ctx context.Context, wd string) ([]string, error) {
+	exec, err := tf.terraform(ctx, wd)
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := exec.Show(ctx)
+	if err != nil {
+		return nil, countError("show", err)
+	}
+
+	addresses := []string{}
+	if state == nil || state.Values == nil {
+		return addresses, nil
+	}
+	modules := []*tfjson.StateModule{state.Values.RootModule}
+	for len(modules) > 0 {
+		m := modules[0]
+		modules = modules[1:]
+		if m == nil {
+			continue
+		}
+		for _, r := range m.Resources {
+			if r.Mode == tfjson.ManagedResourceMode {
+				addresses = append(addresses, r.Address)
+			}
+		}
+		modules = append(modules, m.ChildModules...)
+	}
+	return addresses, nil
+}
@@ -0,0 +1,79 @@
+package terraform
+
+import (
+	"context"
+	"fmt"
+	"path"
+
+	"github.com/hashicorp/terraform-exec/tfexec"
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/rs/zerolog/log"
+	"github.com/supabase/supabench/internal/redact"
+)
+
+// planFile is where Plan saves the plan inside the working directory.
+const planFile = "supabench.tfplan"
+
+// Plan plans the configuration in wd, which has to be initialized first,
+// and returns the human readable plan together with the JSON plan.
+func (tf *TfExec) Plan(ctx context.Context, wd string, envs, benchVars map[string]string, execOpts ExecOptions, r *redact.Redactor) (string, *tfjson.Plan, error) {
+	exec, err := tf.terraform(ctx, wd)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if err = exec.SetEnv(tf.enrichEnv(envs)); err != nil {
+		return "", nil, err
+	}
+	opts := []tfexec.PlanOption{tfexec.Out(planFile)}
+	for k, v := range tf.moduleVars(wd, benchVars) {
+		opts = append(opts, tfexec.Var(fmt.Sprintf("%s=%s", k, v)))
+	}
+
+	log.Info().Str("path", wd).Msg("planning terraform")
+	logger := tfLog{
+		cmd:    "terraform plan",
+		redact: r,
+	}
+	exec.SetLogger(&logger)
+	opts = append(opts, execOpts.planOptions()...)
+	if _, err := exec.Plan(ctx, opts...); err != nil {
+		return "", nil, countError("plan", err)
+	}
+
+	out, err := exec.ShowPlanFileRaw(ctx, path.Join(wd, planFile))
+	if err != nil {
+		return "", nil, err
+	}
+	plan, err := exec.ShowPlanFile(ctx, path.Join(wd, planFile))
+	if err != nil {
+		return "", nil, err
+	}
+	return out, plan, nil
+}
+
+// PlanSummary counts the resource changes of the plan, like the last line
+// of terraform plan.
+func PlanSummary(plan *tfjson.Plan) string {
+	add, change, destroy := 0, 0, 0
+	if plan != nil {
+		for _, rc := range plan.ResourceChanges {
+			if rc.Change == nil {
+				continue
+			}
+			a := rc.Change.Actions
+			switch {
+			case a.Replace():
+				add++
+				destroy++
+			case a.Create():
+				add++
+			case a.Update():
+				change++
+			case a.Delete():
+				destroy++
+			}
+		}
+	}
+	return fmt.Sprintf("Plan: %d to add, %d to change, %d to destroy.", add, change, destroy)
+}
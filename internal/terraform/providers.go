@@ -0,0 +1,76 @@
+package terraform
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/terraform-exec/tfexec"
+)
+
+// cliConfigEnv points terraform to the CLI configuration written by
+// cliConfig.
+const cliConfigEnv = "TF_CLI_CONFIG_FILE"
+
+// cliConfig writes the terraform CLI configuration shared by all runs: the
+// provider plugin cache and, if configured, a filesystem provider mirror
+// that is tried before the registry, or instead of it with MirrorOnly.
+func (tf *TfExec) cliConfig() (string, error) {
+	tf.cliOnce.Do(func() {
+		tf.cliPath, tf.cliErr = writeCLIConfig(tf.opts)
+	})
+	return tf.cliPath, tf.cliErr
+}
+
+func writeCLIConfig(opts Options) (string, error) {
+	cacheDir, err := filepath.Abs(opts.PluginCacheDir)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "plugin_cache_dir = %q\n", cacheDir)
+	if opts.ProviderMirror != "" {
+		mirror, err := filepath.Abs(opts.ProviderMirror)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString("\nprovider_installation {\n")
+		fmt.Fprintf(&b, "  filesystem_mirror {\n    path = %q\n  }\n", mirror)
+		if !opts.MirrorOnly {
+			b.WriteString("  direct {}\n")
+		}
+		b.WriteString("}\n")
+	}
+
+	path := filepath.Join(filepath.Dir(cacheDir), "supabench.tfrc")
+	if err := os.WriteFile(path, []byte(b.String()), 0644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// initEnv is the environment of terraform init: the supabench environment
+// with the shared CLI configuration.
+func (tf *TfExec) initEnv() (map[string]string, error) {
+	env := map[string]string{}
+	for _, kv := range os.Environ() {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			env[k] = v
+		}
+	}
+	for _, k := range tfexec.ProhibitedEnv(env) {
+		delete(env, k)
+	}
+
+	path, err := tf.cliConfig()
+	if err != nil {
+		return nil, err
+	}
+	env[cliConfigEnv] = path
+	return env, nil
+}
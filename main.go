@@ -2,15 +2,14 @@ package main
 
 import (
 	"context"
+	"os"
 
-	"github.com/hashicorp/go-version"
-	"github.com/hashicorp/hc-install/product"
-	"github.com/hashicorp/hc-install/releases"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/viper"
 
 	"github.com/pocketbase/pocketbase"
+	"github.com/supabase/supabench/internal/cli"
 	"github.com/supabase/supabench/internal/execution"
 	"github.com/supabase/supabench/internal/gh"
 	"github.com/supabase/supabench/internal/terraform"
@@ -24,24 +23,33 @@ func main() {
 
 	log.Logger = log.Level(zerolog.InfoLevel)
 
-	installer := &releases.ExactVersion{
-		Product: product.Terraform,
-		Version: version.Must(version.NewVersion("1.2.6")),
-	}
+	pb := pocketbase.New()
 
-	execPath, err := installer.Install(context.Background())
-	if err != nil {
-		log.Fatal().Err(err).Msg("error installing Terraform")
+	// client commands talk to a running server, so they skip the app setup
+	cli.AddCommands(pb.RootCmd)
+	if cli.IsClientCommand(os.Args[1:]) {
+		os.Exit(cli.Execute(pb.RootCmd))
 	}
 
-	tf := terraform.New(execPath)
-	pb := pocketbase.New()
+	// terraform is installed on first use, so that supabench starts offline
+	bins := terraform.NewBinaries()
+	go func() {
+		if _, err := bins.Find(context.Background(), ""); err != nil {
+			log.Warn().Err(err).Msg("default Terraform version is not available")
+		}
+	}()
+
+	tf := terraform.New(bins)
 	gh := gh.New(pb)
 	app := execution.New(pb, tf, gh)
 
 	pipelines.InitRoutes(app)
 	pipelines.InitUI(app)
 	pipelines.InitUser(app)
+	pipelines.InitRedact(app)
+	pipelines.InitSecrets(app)
+	pipelines.InitRuns(app)
+	pipelines.InitBenchmarks(app)
 
 	go func() {
 		if err := app.NewCron(); err != nil {
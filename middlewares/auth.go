@@ -1,6 +1,8 @@
 package middlewares
 
 import (
+	"crypto/subtle"
+
 	"github.com/labstack/echo/v5"
 	"github.com/pocketbase/pocketbase/apis"
 	"github.com/pocketbase/pocketbase/models"
@@ -28,3 +30,22 @@ func RequireAdminOrPrivilegedAuth() echo.MiddlewareFunc {
 		}
 	}
 }
+
+// RequireBearerToken middleware requires a request to have the given
+// `Authorization: Bearer ...` header set, unless the token is empty.
+func RequireBearerToken(token string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if token == "" {
+				return next(c)
+			}
+
+			got := c.Request().Header.Get("Authorization")
+			if subtle.ConstantTimeCompare([]byte(got), []byte("Bearer "+token)) != 1 {
+				return rest.NewUnauthorizedError("The request requires a valid bearer token to be set.", nil)
+			}
+
+			return next(c)
+		}
+	}
+}
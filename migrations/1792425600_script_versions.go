@@ -0,0 +1,123 @@
+package migrations
+
+import (
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/daos"
+	m "github.com/pocketbase/pocketbase/migrations"
+	pbm "github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/models/schema"
+)
+
+func init() {
+	m.Register(func(db dbx.Builder) error {
+		dao := daos.New(db)
+		registeredRule := "@request.user.id != \"\""
+		privilegedRule := registeredRule + " && @request.user.profile.role = \"privileged\""
+
+		// Every uploaded benchmark script is kept as a separate version
+		scriptVersions := &pbm.Collection{
+			BaseModel:  pbm.BaseModel{},
+			Name:       "script_versions",
+			System:     false,
+			ListRule:   &privilegedRule,
+			ViewRule:   &privilegedRule,
+			CreateRule: nil,
+			UpdateRule: nil,
+			DeleteRule: nil,
+			Schema: schema.NewSchema(
+				&schema.SchemaField{
+					Name:     "secret_id",
+					Type:     schema.FieldTypeRelation,
+					Required: true,
+					Options: &schema.RelationOptions{
+						MaxSelect:     1,
+						CollectionId:  "secrets",
+						CascadeDelete: true,
+					},
+				},
+				&schema.SchemaField{
+					Name:     "benchmark_id",
+					Type:     schema.FieldTypeRelation,
+					Required: true,
+					Options: &schema.RelationOptions{
+						MaxSelect:     1,
+						CollectionId:  "benchmarks",
+						CascadeDelete: true,
+					},
+				},
+				&schema.SchemaField{
+					Name: "script",
+					Type: schema.FieldTypeFile,
+					Options: &schema.FileOptions{
+						MaxSelect: 1,
+						MaxSize:   5242880,
+						MimeTypes: []string{
+							"application/zip",
+							"application/vnd.rar",
+							"application/x-tar",
+						},
+					},
+				},
+				&schema.SchemaField{
+					Name:     "hash",
+					Type:     schema.FieldTypeText,
+					Required: true,
+					Options:  &schema.TextOptions{},
+				},
+				&schema.SchemaField{
+					Name:    "uploader",
+					Type:    schema.FieldTypeText,
+					Options: &schema.TextOptions{},
+				},
+				&schema.SchemaField{
+					Name:    "note",
+					Type:    schema.FieldTypeText,
+					Options: &schema.TextOptions{},
+				},
+			),
+		}
+		if err := dao.SaveCollection(scriptVersions); err != nil {
+			return err
+		}
+
+		// Runs record the script version and vars they were executed with
+		runs, err := dao.FindCollectionByNameOrId("runs")
+		if err != nil {
+			return err
+		}
+		runs.Schema.AddField(&schema.SchemaField{
+			Name:     "script_version_id",
+			Type:     schema.FieldTypeRelation,
+			Required: false,
+			Options: &schema.RelationOptions{
+				MaxSelect:     1,
+				CollectionId:  "script_versions",
+				CascadeDelete: false,
+			},
+		})
+		runs.Schema.AddField(&schema.SchemaField{
+			Name:    "resolved_vars",
+			Type:    schema.FieldTypeJson,
+			Options: &schema.JsonOptions{},
+		})
+
+		return dao.SaveCollection(runs)
+	}, func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		runs, err := dao.FindCollectionByNameOrId("runs")
+		if err != nil {
+			return err
+		}
+		for _, name := range []string{"script_version_id", "resolved_vars"} {
+			f := runs.Schema.GetFieldByName(name)
+			runs.Schema.RemoveField(f.Id)
+		}
+		if err := dao.SaveCollection(runs); err != nil {
+			return err
+		}
+
+		_, err = db.DropTable("script_versions").Execute()
+		return err
+	}, "migrations/1792425600_script_versions.go")
+}
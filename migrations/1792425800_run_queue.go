@@ -0,0 +1,65 @@
+package migrations
+
+import (
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/daos"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/models/schema"
+)
+
+func init() {
+	m.Register(func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		c, err := dao.FindCollectionByNameOrId("runs")
+		if err != nil {
+			return err
+		}
+		c.Schema.AddField(&schema.SchemaField{
+			Name:    "priority",
+			Type:    schema.FieldTypeNumber,
+			Options: &schema.NumberOptions{},
+		})
+		c.Schema.AddField(&schema.SchemaField{
+			Name:    "executed_at",
+			Type:    schema.FieldTypeDate,
+			Options: &schema.DateOptions{},
+		})
+		c.Schema.AddField(&schema.SchemaField{
+			Name:    "finished_at",
+			Type:    schema.FieldTypeDate,
+			Options: &schema.DateOptions{},
+		})
+
+		// dropped runs stay in history as cancelled
+		status := c.Schema.GetFieldByName("status")
+		options := status.Options.(*schema.SelectOptions)
+		options.Values = append(options.Values, "cancelled")
+
+		return dao.SaveCollection(c)
+	}, func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		c, err := dao.FindCollectionByNameOrId("runs")
+		if err != nil {
+			return err
+		}
+
+		for _, name := range []string{"priority", "executed_at", "finished_at"} {
+			f := c.Schema.GetFieldByName(name)
+			c.Schema.RemoveField(f.Id)
+		}
+
+		status := c.Schema.GetFieldByName("status")
+		options := status.Options.(*schema.SelectOptions)
+		values := []string{}
+		for _, v := range options.Values {
+			if v != "cancelled" {
+				values = append(values, v)
+			}
+		}
+		options.Values = values
+
+		return dao.SaveCollection(c)
+	}, "migrations/1792425800_run_queue.go")
+}
@@ -0,0 +1,43 @@
+package migrations
+
+import (
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/daos"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/models/schema"
+)
+
+func init() {
+	m.Register(func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		c, err := dao.FindCollectionByNameOrId("runs")
+		if err != nil {
+			return err
+		}
+		c.Schema.AddField(&schema.SchemaField{
+			Name:     "superseded_by",
+			Type:     schema.FieldTypeRelation,
+			Required: false,
+			Options: &schema.RelationOptions{
+				MaxSelect:     1,
+				CollectionId:  "runs",
+				CascadeDelete: false,
+			},
+		})
+
+		return dao.SaveCollection(c)
+	}, func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		c, err := dao.FindCollectionByNameOrId("runs")
+		if err != nil {
+			return err
+		}
+
+		f := c.Schema.GetFieldByName("superseded_by")
+		c.Schema.RemoveField(f.Id)
+
+		return dao.SaveCollection(c)
+	}, "migrations/1792425900_add_superseded_by_to_run.go")
+}
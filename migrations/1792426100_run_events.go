@@ -0,0 +1,107 @@
+package migrations
+
+import (
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/daos"
+	m "github.com/pocketbase/pocketbase/migrations"
+	pbm "github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/models/schema"
+)
+
+var runStatuses = []string{
+	"pending",
+	"provisioning",
+	"running",
+	"success",
+	"fail",
+	"timeout",
+	"cancelled",
+	"tearing_down",
+	"finished",
+}
+
+func init() {
+	m.Register(func(db dbx.Builder) error {
+		dao := daos.New(db)
+		anyoneRule := ""
+
+		// History of run status transitions
+		runEvents := &pbm.Collection{
+			BaseModel:  pbm.BaseModel{},
+			Name:       "run_events",
+			System:     false,
+			ListRule:   &anyoneRule,
+			ViewRule:   &anyoneRule,
+			CreateRule: nil,
+			UpdateRule: nil,
+			DeleteRule: nil,
+			Schema: schema.NewSchema(
+				&schema.SchemaField{
+					Name:     "run_id",
+					Type:     schema.FieldTypeRelation,
+					Required: true,
+					Options: &schema.RelationOptions{
+						MaxSelect:     1,
+						CollectionId:  "runs",
+						CascadeDelete: true,
+					},
+				},
+				&schema.SchemaField{
+					Name:    "from_status",
+					Type:    schema.FieldTypeText,
+					Options: &schema.TextOptions{},
+				},
+				&schema.SchemaField{
+					Name:     "to_status",
+					Type:     schema.FieldTypeText,
+					Required: true,
+					Options:  &schema.TextOptions{},
+				},
+				&schema.SchemaField{
+					Name:    "source",
+					Type:    schema.FieldTypeText,
+					Options: &schema.TextOptions{},
+				},
+				&schema.SchemaField{
+					Name:    "reason",
+					Type:    schema.FieldTypeText,
+					Options: &schema.TextOptions{},
+				},
+			),
+		}
+		if err := dao.SaveCollection(runEvents); err != nil {
+			return err
+		}
+
+		runs, err := dao.FindCollectionByNameOrId("runs")
+		if err != nil {
+			return err
+		}
+		status := runs.Schema.GetFieldByName("status")
+		status.Options.(*schema.SelectOptions).Values = runStatuses
+
+		return dao.SaveCollection(runs)
+	}, func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		runs, err := dao.FindCollectionByNameOrId("runs")
+		if err != nil {
+			return err
+		}
+		status := runs.Schema.GetFieldByName("status")
+		status.Options.(*schema.SelectOptions).Values = []string{
+			"pending",
+			"running",
+			"success",
+			"fail",
+			"finished",
+			"cancelled",
+		}
+		if err := dao.SaveCollection(runs); err != nil {
+			return err
+		}
+
+		_, err = db.DropTable("run_events").Execute()
+		return err
+	}, "migrations/1792426100_run_events.go")
+}
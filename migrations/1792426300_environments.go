@@ -0,0 +1,96 @@
+package migrations
+
+import (
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/daos"
+	m "github.com/pocketbase/pocketbase/migrations"
+	pbm "github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/models/schema"
+)
+
+func init() {
+	m.Register(func(db dbx.Builder) error {
+		dao := daos.New(db)
+		registeredRule := "@request.user.id != \"\""
+		privilegedRule := registeredRule + " && @request.user.profile.role = \"privileged\""
+
+		// Long-lived systems under test shared by consecutive runs
+		environments := &pbm.Collection{
+			BaseModel:  pbm.BaseModel{},
+			Name:       "environments",
+			System:     false,
+			ListRule:   &privilegedRule,
+			ViewRule:   &privilegedRule,
+			CreateRule: nil,
+			UpdateRule: nil,
+			DeleteRule: nil,
+			Schema: schema.NewSchema(
+				&schema.SchemaField{
+					Name:     "benchmark_id",
+					Type:     schema.FieldTypeRelation,
+					Required: true,
+					Options: &schema.RelationOptions{
+						MaxSelect:     1,
+						CollectionId:  "benchmarks",
+						CascadeDelete: false,
+					},
+				},
+				&schema.SchemaField{
+					Name:     "key",
+					Type:     schema.FieldTypeText,
+					Required: true,
+					Options:  &schema.TextOptions{},
+				},
+				&schema.SchemaField{
+					Name:    "run_id",
+					Type:    schema.FieldTypeText,
+					Options: &schema.TextOptions{},
+				},
+				&schema.SchemaField{
+					Name:     "status",
+					Type:     schema.FieldTypeSelect,
+					Required: true,
+					Options: &schema.SelectOptions{
+						MaxSelect: 1,
+						Values:    []string{"up", "destroyed"},
+					},
+				},
+				&schema.SchemaField{
+					Name:    "last_used_at",
+					Type:    schema.FieldTypeDate,
+					Options: &schema.DateOptions{},
+				},
+			),
+		}
+		if err := dao.SaveCollection(environments); err != nil {
+			return err
+		}
+
+		runs, err := dao.FindCollectionByNameOrId("runs")
+		if err != nil {
+			return err
+		}
+		runs.Schema.AddField(&schema.SchemaField{
+			Name:    "environment_id",
+			Type:    schema.FieldTypeText,
+			Options: &schema.TextOptions{},
+		})
+
+		return dao.SaveCollection(runs)
+	}, func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		runs, err := dao.FindCollectionByNameOrId("runs")
+		if err != nil {
+			return err
+		}
+		f := runs.Schema.GetFieldByName("environment_id")
+		runs.Schema.RemoveField(f.Id)
+		if err := dao.SaveCollection(runs); err != nil {
+			return err
+		}
+
+		_, err = db.DropTable("environments").Execute()
+		return err
+	}, "migrations/1792426300_environments.go")
+}
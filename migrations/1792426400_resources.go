@@ -0,0 +1,106 @@
+package migrations
+
+import (
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/daos"
+	m "github.com/pocketbase/pocketbase/migrations"
+	pbm "github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/models/schema"
+)
+
+func init() {
+	m.Register(func(db dbx.Builder) error {
+		dao := daos.New(db)
+		registeredRule := "@request.user.id != \"\""
+		privilegedRule := registeredRule + " && @request.user.profile.role = \"privileged\""
+
+		// Terraform working directories that may hold provisioned resources
+		resources := &pbm.Collection{
+			BaseModel:  pbm.BaseModel{},
+			Name:       "resources",
+			System:     false,
+			ListRule:   &privilegedRule,
+			ViewRule:   &privilegedRule,
+			CreateRule: nil,
+			UpdateRule: nil,
+			DeleteRule: nil,
+			Schema: schema.NewSchema(
+				&schema.SchemaField{
+					Name:     "run_id",
+					Type:     schema.FieldTypeText,
+					Required: true,
+					Options:  &schema.TextOptions{},
+				},
+				&schema.SchemaField{
+					Name:     "benchmark_id",
+					Type:     schema.FieldTypeText,
+					Required: true,
+					Options:  &schema.TextOptions{},
+				},
+				&schema.SchemaField{
+					Name:    "environment_id",
+					Type:    schema.FieldTypeText,
+					Options: &schema.TextOptions{},
+				},
+				&schema.SchemaField{
+					Name:     "kind",
+					Type:     schema.FieldTypeSelect,
+					Required: true,
+					Options: &schema.SelectOptions{
+						MaxSelect: 1,
+						Values:    []string{"run", "environment"},
+					},
+				},
+				&schema.SchemaField{
+					Name:     "working_dir",
+					Type:     schema.FieldTypeText,
+					Required: true,
+					Options:  &schema.TextOptions{},
+				},
+				&schema.SchemaField{
+					Name:     "status",
+					Type:     schema.FieldTypeSelect,
+					Required: true,
+					Options: &schema.SelectOptions{
+						MaxSelect: 1,
+						Values:    []string{"provisioned", "leaked", "destroyed"},
+					},
+				},
+				&schema.SchemaField{
+					Name:    "addresses",
+					Type:    schema.FieldTypeJson,
+					Options: &schema.JsonOptions{},
+				},
+				&schema.SchemaField{
+					Name:    "attempts",
+					Type:    schema.FieldTypeNumber,
+					Options: &schema.NumberOptions{},
+				},
+				&schema.SchemaField{
+					Name:    "next_attempt_at",
+					Type:    schema.FieldTypeDate,
+					Options: &schema.DateOptions{},
+				},
+				&schema.SchemaField{
+					Name:    "last_error",
+					Type:    schema.FieldTypeText,
+					Options: &schema.TextOptions{},
+				},
+				&schema.SchemaField{
+					Name:    "alerted_at",
+					Type:    schema.FieldTypeDate,
+					Options: &schema.DateOptions{},
+				},
+				&schema.SchemaField{
+					Name:    "destroyed_at",
+					Type:    schema.FieldTypeDate,
+					Options: &schema.DateOptions{},
+				},
+			),
+		}
+		return dao.SaveCollection(resources)
+	}, func(db dbx.Builder) error {
+		_, err := db.DropTable("resources").Execute()
+		return err
+	}, "migrations/1792426400_resources.go")
+}
@@ -0,0 +1,49 @@
+package migrations
+
+import (
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/daos"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/models/schema"
+)
+
+func init() {
+	m.Register(func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		c, err := dao.FindCollectionByNameOrId("runs")
+		if err != nil {
+			return err
+		}
+		c.Schema.AddField(&schema.SchemaField{
+			Name:    "dry_run",
+			Type:    schema.FieldTypeBool,
+			Options: &schema.BoolOptions{},
+		})
+		c.Schema.AddField(&schema.SchemaField{
+			Name:    "plan",
+			Type:    schema.FieldTypeText,
+			Options: &schema.TextOptions{},
+		})
+		c.Schema.AddField(&schema.SchemaField{
+			Name:    "plan_json",
+			Type:    schema.FieldTypeJson,
+			Options: &schema.JsonOptions{},
+		})
+
+		return dao.SaveCollection(c)
+	}, func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		c, err := dao.FindCollectionByNameOrId("runs")
+		if err != nil {
+			return err
+		}
+		for _, name := range []string{"dry_run", "plan", "plan_json"} {
+			f := c.Schema.GetFieldByName(name)
+			c.Schema.RemoveField(f.Id)
+		}
+
+		return dao.SaveCollection(c)
+	}, "migrations/1792426500_add_dry_run_to_run.go")
+}
@@ -0,0 +1,44 @@
+package migrations
+
+import (
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/daos"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/models/schema"
+)
+
+func init() {
+	m.Register(func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		c, err := dao.FindCollectionByNameOrId("runs")
+		if err != nil {
+			return err
+		}
+		c.Schema.AddField(&schema.SchemaField{
+			Name:    "pinned",
+			Type:    schema.FieldTypeBool,
+			Options: &schema.BoolOptions{},
+		})
+		c.Schema.AddField(&schema.SchemaField{
+			Name:    "compacted_at",
+			Type:    schema.FieldTypeDate,
+			Options: &schema.DateOptions{},
+		})
+
+		return dao.SaveCollection(c)
+	}, func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		c, err := dao.FindCollectionByNameOrId("runs")
+		if err != nil {
+			return err
+		}
+		for _, name := range []string{"pinned", "compacted_at"} {
+			f := c.Schema.GetFieldByName(name)
+			c.Schema.RemoveField(f.Id)
+		}
+
+		return dao.SaveCollection(c)
+	}, "migrations/1792426700_add_retention_to_run.go")
+}
@@ -0,0 +1,43 @@
+package migrations
+
+import (
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/daos"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/models/schema"
+)
+
+func init() {
+	m.Register(func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		c, err := dao.FindCollectionByNameOrId("runs")
+		if err != nil {
+			return err
+		}
+		// the window the loader generated load in, unlike started_at and
+		// ended_at which are padded for the Grafana links
+		for _, name := range []string{"load_started_at", "load_ended_at"} {
+			c.Schema.AddField(&schema.SchemaField{
+				Name:    name,
+				Type:    schema.FieldTypeText,
+				Options: &schema.TextOptions{},
+			})
+		}
+
+		return dao.SaveCollection(c)
+	}, func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		c, err := dao.FindCollectionByNameOrId("runs")
+		if err != nil {
+			return err
+		}
+		for _, name := range []string{"load_started_at", "load_ended_at"} {
+			f := c.Schema.GetFieldByName(name)
+			c.Schema.RemoveField(f.Id)
+		}
+
+		return dao.SaveCollection(c)
+	}, "migrations/1792426800_add_load_window_to_run.go")
+}
@@ -0,0 +1,47 @@
+package migrations
+
+import (
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/daos"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/models/schema"
+)
+
+func init() {
+	m.Register(func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		c, err := dao.FindCollectionByNameOrId("environments")
+		if err != nil {
+			return err
+		}
+		// the vars the environment was applied with, so that it is destroyed
+		// with them. Values from the secret are masked and listed in
+		// secret_vars, they are read from the secret again on destroy.
+		c.Schema.AddField(&schema.SchemaField{
+			Name:    "vars",
+			Type:    schema.FieldTypeJson,
+			Options: &schema.JsonOptions{},
+		})
+		c.Schema.AddField(&schema.SchemaField{
+			Name:    "secret_vars",
+			Type:    schema.FieldTypeJson,
+			Options: &schema.JsonOptions{},
+		})
+
+		return dao.SaveCollection(c)
+	}, func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		c, err := dao.FindCollectionByNameOrId("environments")
+		if err != nil {
+			return err
+		}
+		for _, name := range []string{"vars", "secret_vars"} {
+			f := c.Schema.GetFieldByName(name)
+			c.Schema.RemoveField(f.Id)
+		}
+
+		return dao.SaveCollection(c)
+	}, "migrations/1792427000_add_vars_to_environment.go")
+}
@@ -7,38 +7,122 @@ import (
 
 type Run struct {
 	models.BaseModel
-	BenchmarkID string         `json:"benchmark_id"`
-	Name        string         `json:"name"`
-	Origin      *string        `json:"origin"`
-	Status      string         `json:"status" omitempty:"true"`
-	StartedAt   *string        `json:"started_at"`
-	EndedAt     *string        `json:"ended_at"`
-	Output      *string        `json:"output"`
-	TriggeredAt types.DateTime `json:"triggered_at"`
-	Errors      *string        `json:"errors" omitempty:"true"`
-	Meta        *string        `json:"meta" omitempty:"true"`
-	Raw         *string        `json:"raw" omitempty:"true"`
-	Comment     *string        `json:"comment" omitempty:"true"`
-	Vars        *string        `json:"vars" omitempty:"true"`
-	GitHubPRID  *string        `json:"github_pr_id" omitempty:"true" db:"github_pr_id"`
+	BenchmarkID     string         `json:"benchmark_id"`
+	Name            string         `json:"name"`
+	Origin          *string        `json:"origin"`
+	Status          string         `json:"status" omitempty:"true"`
+	StartedAt       *string        `json:"started_at"`
+	EndedAt         *string        `json:"ended_at"`
+	Output          *string        `json:"output"`
+	TriggeredAt     types.DateTime `json:"triggered_at"`
+	Errors          *string        `json:"errors" omitempty:"true"`
+	Meta            *string        `json:"meta" omitempty:"true"`
+	Raw             *string        `json:"raw" omitempty:"true"`
+	Comment         *string        `json:"comment" omitempty:"true"`
+	Vars            *string        `json:"vars" omitempty:"true"`
+	GitHubPRID      *string        `json:"github_pr_id" omitempty:"true" db:"github_pr_id"`
+	ScriptVersionID *string        `json:"script_version_id" omitempty:"true"`
+	ResolvedVars    *string        `json:"resolved_vars" omitempty:"true"`
+	SourceRunID     *string        `json:"source_run_id" omitempty:"true"`
+	Priority        int            `json:"priority"`
+	ExecutedAt      types.DateTime `json:"executed_at"`
+	FinishedAt      types.DateTime `json:"finished_at"`
+	SupersededBy    *string        `json:"superseded_by" omitempty:"true"`
+	ExternalID      *string        `json:"external_id" omitempty:"true"`
+	Phases          *string        `json:"phases" omitempty:"true"`
+	EnvironmentID   *string        `json:"environment_id" omitempty:"true"`
+	DryRun          bool           `json:"dry_run"`
+	Plan            *string        `json:"plan" omitempty:"true"`
+	PlanJSON        *string        `json:"plan_json" omitempty:"true" db:"plan_json"`
+	Outputs         *string        `json:"outputs" omitempty:"true"`
+	Pinned          bool           `json:"pinned"`
+	CompactedAt     types.DateTime `json:"compacted_at"`
+	LoadStartedAt   *string        `json:"load_started_at"`
+	LoadEndedAt     *string        `json:"load_ended_at"`
+	SummaryPushedAt types.DateTime `json:"summary_pushed_at"`
 }
 
 func (r Run) TableName() string {
 	return "runs"
 }
 
+type RunEvent struct {
+	models.BaseModel
+	RunID      string  `json:"run_id"`
+	FromStatus string  `json:"from_status"`
+	ToStatus   string  `json:"to_status"`
+	Source     string  `json:"source"`
+	Reason     *string `json:"reason" omitempty:"true"`
+}
+
+func (e RunEvent) TableName() string {
+	return "run_events"
+}
+
+type Environment struct {
+	models.BaseModel
+	BenchmarkID string         `json:"benchmark_id"`
+	Key         string         `json:"key"`
+	RunID       string         `json:"run_id"`
+	Status      string         `json:"status"`
+	LastUsedAt  types.DateTime `json:"last_used_at"`
+	Vars        *string        `json:"vars" omitempty:"true"`
+	SecretVars  *string        `json:"secret_vars" omitempty:"true"`
+}
+
+func (e Environment) TableName() string {
+	return "environments"
+}
+
+type Resource struct {
+	models.BaseModel
+	RunID         string         `json:"run_id"`
+	BenchmarkID   string         `json:"benchmark_id"`
+	EnvironmentID *string        `json:"environment_id" omitempty:"true"`
+	Kind          string         `json:"kind"`
+	WorkingDir    string         `json:"working_dir"`
+	Status        string         `json:"status"`
+	Addresses     *string        `json:"addresses" omitempty:"true"`
+	Attempts      int            `json:"attempts"`
+	NextAttemptAt types.DateTime `json:"next_attempt_at"`
+	LastError     *string        `json:"last_error" omitempty:"true"`
+	AlertedAt     types.DateTime `json:"alerted_at"`
+	DestroyedAt   types.DateTime `json:"destroyed_at"`
+}
+
+func (r Resource) TableName() string {
+	return "resources"
+}
+
 type Secret struct {
 	models.BaseModel
-	Script     *string `json:"script" omitempty:"true"`
-	ScriptLink *string `json:"script_link" omitempty:"true"`
-	Env        *string `json:"env" omitempty:"true"`
-	Vars       *string `json:"vars" omitempty:"true"`
+	OwnerID     string  `json:"owner_id"`
+	BenchmarkID string  `json:"benchmark_id"`
+	Script      *string `json:"script" omitempty:"true"`
+	ScriptLink  *string `json:"script_link" omitempty:"true"`
+	Env         *string `json:"env" omitempty:"true"`
+	Vars        *string `json:"vars" omitempty:"true"`
+	Validation  *string `json:"validation" omitempty:"true"`
 }
 
 func (s Secret) TableName() string {
 	return "secrets"
 }
 
+type ScriptVersion struct {
+	models.BaseModel
+	SecretID    string  `json:"secret_id"`
+	BenchmarkID string  `json:"benchmark_id"`
+	Script      string  `json:"script"`
+	Hash        string  `json:"hash"`
+	Uploader    *string `json:"uploader" omitempty:"true"`
+	Note        *string `json:"note" omitempty:"true"`
+}
+
+func (s ScriptVersion) TableName() string {
+	return "script_versions"
+}
+
 type PR struct {
 	models.BaseModel
 	PRLink        *string `json:"pr_link" omitempty:"true" db:"pr_link"`
@@ -50,6 +134,19 @@ func (p PR) TableName() string {
 	return "github_prs"
 }
 
+type Project struct {
+	models.BaseModel
+	OwnerID string  `json:"owner_id"`
+	Name    string  `json:"name"`
+	Slug    string  `json:"slug"`
+	Repo    *string `json:"repo,omitempty"`
+	Meta    *string `json:"meta,omitempty"`
+}
+
+func (p Project) TableName() string {
+	return "projects"
+}
+
 type Benchmark struct {
 	models.BaseModel
 	OwnerID           string  `json:"owner_id"`
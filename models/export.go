@@ -0,0 +1,46 @@
+package models
+
+import "github.com/pocketbase/pocketbase/tools/types"
+
+// ExportVersion is the version of the export format supabench writes and
+// reads.
+const ExportVersion = 1
+
+// Types of export records.
+const (
+	ExportHeader    = "header"
+	ExportProject   = "project"
+	ExportBenchmark = "benchmark"
+	ExportPR        = "pr"
+	ExportRun       = "run"
+	ExportRunEvent  = "run_event"
+)
+
+// ExportRecord is a line of an export. The first line is a header with the
+// format version, followed by projects, benchmarks, PRs and runs, each run
+// followed by its events. Secrets are never exported.
+type ExportRecord struct {
+	Type       string          `json:"type"`
+	Version    int             `json:"version,omitempty"`
+	ExportedAt *types.DateTime `json:"exported_at,omitempty"`
+	Project    *Project        `json:"project,omitempty"`
+	Benchmark  *Benchmark      `json:"benchmark,omitempty"`
+	PR         *PR             `json:"pr,omitempty"`
+	Run        *Run            `json:"run,omitempty"`
+	RunEvent   *RunEvent       `json:"run_event,omitempty"`
+}
+
+// ImportCount counts what happened to the records of a type on import.
+type ImportCount struct {
+	Created int `json:"created"`
+	Updated int `json:"updated"`
+	Skipped int `json:"skipped"`
+	// Remapped counts records stored under a new ID because theirs was
+	// taken.
+	Remapped int `json:"remapped"`
+}
+
+type ImportResult struct {
+	DryRun bool                    `json:"dry_run"`
+	Counts map[string]*ImportCount `json:"counts"`
+}
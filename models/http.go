@@ -3,4 +3,6 @@ package models
 type NewRun struct {
 	Run
 	GitHubPRLink string `json:"pr_link"`
+	// Supersede cancels older pending runs of the same benchmark and PR.
+	Supersede bool `json:"supersede"`
 }
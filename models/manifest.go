@@ -0,0 +1,74 @@
+package models
+
+// ManifestVersion is the manifest format version supabench understands.
+const ManifestVersion = 1
+
+// Manifest describes projects and benchmarks as code. Fields that are left
+// out are not changed on apply.
+type Manifest struct {
+	Version  int               `json:"version" yaml:"version"`
+	Owner    string            `json:"owner,omitempty" yaml:"owner,omitempty"`
+	Projects []ManifestProject `json:"projects" yaml:"projects"`
+}
+
+type ManifestProject struct {
+	Slug       string                 `json:"slug" yaml:"slug"`
+	Name       string                 `json:"name" yaml:"name"`
+	Repo       *string                `json:"repo,omitempty" yaml:"repo,omitempty"`
+	Meta       map[string]interface{} `json:"meta,omitempty" yaml:"meta,omitempty"`
+	Benchmarks []ManifestBenchmark    `json:"benchmarks,omitempty" yaml:"benchmarks,omitempty"`
+}
+
+type ManifestBenchmark struct {
+	Slug              string                 `json:"slug" yaml:"slug"`
+	Name              string                 `json:"name" yaml:"name"`
+	GrafanaURL        *string                `json:"grafana_url,omitempty" yaml:"grafana_url,omitempty"`
+	DefaultOrigin     *string                `json:"default_origin,omitempty" yaml:"default_origin,omitempty"`
+	ExtractMetricPath *string                `json:"extract_metric_path,omitempty" yaml:"extract_metric_path,omitempty"`
+	Thresholds        []Threshold            `json:"thresholds,omitempty" yaml:"thresholds,omitempty"`
+	Meta              map[string]interface{} `json:"meta,omitempty" yaml:"meta,omitempty"`
+	// Script is the path of the script archive relative to the manifest.
+	// It is uploaded by the client, the server only reports its hash.
+	Script *string `json:"script,omitempty" yaml:"script,omitempty"`
+	// Vars are the non-secret terraform vars of the benchmark, stored under
+	// vars in the benchmark meta. They are set on top of the stored vars.
+	// Secret vars and env are never part of a manifest.
+	Vars map[string]string `json:"vars,omitempty" yaml:"vars,omitempty"`
+	// RemoveVars are the stored vars to remove.
+	RemoveVars []string `json:"remove_vars,omitempty" yaml:"remove_vars,omitempty"`
+}
+
+// Threshold is a limit on how much a metric of a run may regress compared
+// to a base run, stored under thresholds in the benchmark meta.
+type Threshold struct {
+	// Metric is a JSONPath into the run raw data or a flattened k6 metric
+	// name like http_req_duration.p(95).
+	Metric string `json:"metric" yaml:"metric"`
+	// MaxRegression is the allowed regression in percent.
+	MaxRegression float64 `json:"max_regression" yaml:"max_regression"`
+	// LowerIsBetter treats an increase as a regression, e.g. for latencies.
+	LowerIsBetter bool `json:"lower_is_better,omitempty" yaml:"lower_is_better,omitempty"`
+}
+
+// ManifestChange is a change apply made, or would make in a dry run.
+type ManifestChange struct {
+	Kind   string   `json:"kind"`
+	Slug   string   `json:"slug"`
+	ID     string   `json:"id,omitempty"`
+	Action string   `json:"action"`
+	Fields []string `json:"fields,omitempty"`
+}
+
+// ManifestScript tells the client where to upload the script of a
+// benchmark and the hash of the script that is there now.
+type ManifestScript struct {
+	Benchmark string `json:"benchmark"`
+	SecretID  string `json:"secret_id,omitempty"`
+	Hash      string `json:"hash,omitempty"`
+}
+
+type ManifestResult struct {
+	DryRun  bool             `json:"dry_run"`
+	Changes []ManifestChange `json:"changes"`
+	Scripts []ManifestScript `json:"scripts"`
+}
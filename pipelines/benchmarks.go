@@ -0,0 +1,40 @@
+package pipelines
+
+import (
+	"encoding/json"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/tools/rest"
+	"github.com/supabase/supabench/internal/execution"
+)
+
+// InitBenchmarks rejects benchmarks with terraform options in their meta
+// that supabench does not support, or vars that are not a map of strings.
+func InitBenchmarks(app *execution.App) {
+	app.PB.OnRecordBeforeCreateRequest().Add(func(e *core.RecordCreateEvent) error {
+		return checkExecOptions(e.Record)
+	})
+	app.PB.OnRecordBeforeUpdateRequest().Add(func(e *core.RecordUpdateEvent) error {
+		return checkExecOptions(e.Record)
+	})
+}
+
+func checkExecOptions(record *models.Record) error {
+	if record.TableName() != "benchmarks" {
+		return nil
+	}
+
+	b, err := json.Marshal(record.GetDataValue("meta"))
+	if err != nil || string(b) == "null" {
+		return nil
+	}
+	meta := string(b)
+	if _, err := execution.BenchmarkExecOptions(&meta); err != nil {
+		return rest.NewBadRequestError(err.Error(), nil)
+	}
+	if _, err := execution.BenchmarkVars(&meta); err != nil {
+		return rest.NewBadRequestError(err.Error(), nil)
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package pipelines
+
+import (
+	"encoding/json"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/tools/types"
+	"github.com/rs/zerolog/log"
+	"github.com/supabase/supabench/internal/execution"
+)
+
+// InitRedact scrubs secret values from run output, errors and raw k6 data
+// that loaders post to the runs collection. Errors and raw data stay valid
+// JSON.
+func InitRedact(app *execution.App) {
+	app.PB.OnRecordBeforeCreateRequest().Add(func(e *core.RecordCreateEvent) error {
+		redactRun(app, e.Record)
+		return nil
+	})
+	app.PB.OnRecordBeforeUpdateRequest().Add(func(e *core.RecordUpdateEvent) error {
+		redactRun(app, e.Record)
+		return nil
+	})
+}
+
+func redactRun(app *execution.App, record *models.Record) {
+	if record.TableName() != "runs" {
+		return
+	}
+
+	r, err := app.RedactorFor(record.GetStringDataValue("benchmark_id"))
+	if err != nil {
+		log.Warn().Err(err).Str("run_id", record.Id).Msg("cannot get secrets to redact run")
+	}
+
+	record.SetDataValue("output", r.String(record.GetStringDataValue("output")))
+	for _, field := range []string{"errors", "raw"} {
+		b, err := json.Marshal(record.GetDataValue(field))
+		if err != nil || string(b) == "null" {
+			continue
+		}
+		// only the strings are redacted, numbers equal to a var stay intact
+		record.SetDataValue(field, types.JsonRaw(r.JSON(b)))
+	}
+}
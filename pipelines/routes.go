@@ -4,16 +4,31 @@ import (
 	"net/http"
 
 	"github.com/labstack/echo/v5"
+	"github.com/pocketbase/pocketbase/apis"
 	"github.com/pocketbase/pocketbase/core"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/spf13/viper"
+	"github.com/supabase/supabench/internal/backup"
+	"github.com/supabase/supabench/internal/benchmark"
 	"github.com/supabase/supabench/internal/execution"
+	"github.com/supabase/supabench/internal/manifest"
+	"github.com/supabase/supabench/internal/queue"
+	"github.com/supabase/supabench/internal/resource"
 	"github.com/supabase/supabench/internal/run"
 	"github.com/supabase/supabench/middlewares"
 )
 
 func InitRoutes(app *execution.App) {
 	healthcheck(app)
+	monitoring(app)
 
 	runs(app)
+	benchmarks(app)
+	runsQueue(app)
+	resources(app)
+	manifests(app)
+	backups(app)
 }
 
 func healthcheck(app *execution.App) {
@@ -42,6 +57,23 @@ func healthcheck(app *execution.App) {
 	})
 }
 
+// monitoring exposes Prometheus metrics, protected by
+// SUPABENCH_METRICS_TOKEN if it is set.
+func monitoring(app *execution.App) {
+	prometheus.MustRegister(app.Collector())
+	app.PB.OnBeforeServe().Add(func(e *core.ServeEvent) error {
+		e.Router.AddRoute(echo.Route{
+			Method:  http.MethodGet,
+			Path:    "/api/metrics",
+			Handler: echo.WrapHandler(promhttp.Handler()),
+			Middlewares: []echo.MiddlewareFunc{
+				middlewares.RequireBearerToken(viper.GetString("METRICS_TOKEN")),
+			},
+		})
+		return nil
+	})
+}
+
 func runs(app *execution.App) {
 	app.PB.OnBeforeServe().Add(func(e *core.ServeEvent) error {
 		e.Router.AddRoute(echo.Route{
@@ -52,6 +84,148 @@ func runs(app *execution.App) {
 				middlewares.RequireAdminOrPrivilegedAuth(),
 			},
 		})
+		e.Router.AddRoute(echo.Route{
+			Method:  http.MethodPost,
+			Path:    "/api/runs/:id/rerun",
+			Handler: run.RerunHandler(app),
+			Middlewares: []echo.MiddlewareFunc{
+				middlewares.RequireAdminOrPrivilegedAuth(),
+			},
+		})
+		e.Router.AddRoute(echo.Route{
+			Method:  http.MethodPost,
+			Path:    "/api/runs/:id/cancel",
+			Handler: run.CancelHandler(app),
+			Middlewares: []echo.MiddlewareFunc{
+				middlewares.RequireAdminOrPrivilegedAuth(),
+			},
+		})
+		e.Router.AddRoute(echo.Route{
+			Method:  http.MethodPut,
+			Path:    "/api/runs/:id/pin",
+			Handler: run.PinHandler(app, true),
+			Middlewares: []echo.MiddlewareFunc{
+				middlewares.RequireAdminOrPrivilegedAuth(),
+			},
+		})
+		e.Router.AddRoute(echo.Route{
+			Method:  http.MethodDelete,
+			Path:    "/api/runs/:id/pin",
+			Handler: run.PinHandler(app, false),
+			Middlewares: []echo.MiddlewareFunc{
+				middlewares.RequireAdminOrPrivilegedAuth(),
+			},
+		})
+		return nil
+	})
+}
+
+func benchmarks(app *execution.App) {
+	app.PB.OnBeforeServe().Add(func(e *core.ServeEvent) error {
+		e.Router.AddRoute(echo.Route{
+			Method:  http.MethodGet,
+			Path:    "/api/benchmarks/:id/variables",
+			Handler: benchmark.VariablesHandler(app),
+			Middlewares: []echo.MiddlewareFunc{
+				middlewares.RequireAdminOrPrivilegedAuth(),
+			},
+		})
+		return nil
+	})
+}
+
+func runsQueue(app *execution.App) {
+	app.PB.OnBeforeServe().Add(func(e *core.ServeEvent) error {
+		e.Router.AddRoute(echo.Route{
+			Method:  http.MethodGet,
+			Path:    "/api/queue",
+			Handler: queue.ListHandler(app),
+			Middlewares: []echo.MiddlewareFunc{
+				middlewares.RequireAdminOrPrivilegedAuth(),
+			},
+		})
+		e.Router.AddRoute(echo.Route{
+			Method:  http.MethodPost,
+			Path:    "/api/queue/reorder",
+			Handler: queue.ReorderHandler(app),
+			Middlewares: []echo.MiddlewareFunc{
+				apis.RequireAdminAuth(),
+			},
+		})
+		e.Router.AddRoute(echo.Route{
+			Method:  http.MethodPost,
+			Path:    "/api/queue/:id/bump",
+			Handler: queue.BumpHandler(app),
+			Middlewares: []echo.MiddlewareFunc{
+				apis.RequireAdminAuth(),
+			},
+		})
+		e.Router.AddRoute(echo.Route{
+			Method:  http.MethodPut,
+			Path:    "/api/queue/:id/priority",
+			Handler: queue.PriorityHandler(app),
+			Middlewares: []echo.MiddlewareFunc{
+				apis.RequireAdminAuth(),
+			},
+		})
+		e.Router.AddRoute(echo.Route{
+			Method:  http.MethodDelete,
+			Path:    "/api/queue/:id",
+			Handler: queue.DropHandler(app),
+			Middlewares: []echo.MiddlewareFunc{
+				apis.RequireAdminAuth(),
+			},
+		})
+		return nil
+	})
+}
+
+func resources(app *execution.App) {
+	app.PB.OnBeforeServe().Add(func(e *core.ServeEvent) error {
+		e.Router.AddRoute(echo.Route{
+			Method:  http.MethodGet,
+			Path:    "/api/resources",
+			Handler: resource.ListHandler(app),
+			Middlewares: []echo.MiddlewareFunc{
+				middlewares.RequireAdminOrPrivilegedAuth(),
+			},
+		})
+		return nil
+	})
+}
+
+func manifests(app *execution.App) {
+	app.PB.OnBeforeServe().Add(func(e *core.ServeEvent) error {
+		e.Router.AddRoute(echo.Route{
+			Method:  http.MethodPost,
+			Path:    "/api/apply",
+			Handler: manifest.ApplyHandler(app),
+			Middlewares: []echo.MiddlewareFunc{
+				middlewares.RequireAdminOrPrivilegedAuth(),
+			},
+		})
+		return nil
+	})
+}
+
+func backups(app *execution.App) {
+	app.PB.OnBeforeServe().Add(func(e *core.ServeEvent) error {
+		e.Router.AddRoute(echo.Route{
+			Method:  http.MethodGet,
+			Path:    "/api/export",
+			Handler: backup.ExportHandler(app),
+			Middlewares: []echo.MiddlewareFunc{
+				apis.RequireAdminAuth(),
+			},
+		})
+		e.Router.AddRoute(echo.Route{
+			Method:  http.MethodPost,
+			Path:    "/api/import",
+			Handler: backup.ImportHandler(app),
+			Middlewares: []echo.MiddlewareFunc{
+				apis.RequireAdminAuth(),
+			},
+		})
 		return nil
 	})
 }
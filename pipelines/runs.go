@@ -0,0 +1,63 @@
+package pipelines
+
+import (
+	"errors"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/rest"
+	"github.com/supabase/supabench/internal/execution"
+)
+
+// fromStatusKey holds the status of a run before a collection API update.
+const fromStatusKey = "supabench_run_from_status"
+
+// InitRuns validates status changes that loaders and users make through the
+// runs collection API against the run state machine and records them in the
+// run history.
+func InitRuns(app *execution.App) {
+	app.PB.OnRecordBeforeCreateRequest().Add(func(e *core.RecordCreateEvent) error {
+		if e.Record.TableName() != "runs" {
+			return nil
+		}
+		status := e.Record.GetStringDataValue("status")
+		if !execution.CanTransition("", status) {
+			return rest.NewBadRequestError("runs can not be created with status "+status, nil)
+		}
+		return nil
+	})
+	app.PB.OnRecordAfterCreateRequest().Add(func(e *core.RecordCreateEvent) error {
+		if e.Record.TableName() != "runs" {
+			return nil
+		}
+		app.RecordRunEvent(e.Record.Id, "", e.Record.GetStringDataValue("status"), execution.SourceAPI, "")
+		return nil
+	})
+
+	app.PB.OnRecordBeforeUpdateRequest().Add(func(e *core.RecordUpdateEvent) error {
+		if e.Record.TableName() != "runs" {
+			return nil
+		}
+		status := e.Record.GetStringDataValue("status")
+		from, err := app.CheckTransition(e.Record.Id, status)
+		if errors.Is(err, execution.ErrIllegalTransition) {
+			return rest.NewBadRequestError(err.Error(), nil)
+		}
+		if err != nil {
+			return err
+		}
+		// the transition is recorded once the update is saved
+		e.HttpContext.Set(fromStatusKey, from)
+		return nil
+	})
+	app.PB.OnRecordAfterUpdateRequest().Add(func(e *core.RecordUpdateEvent) error {
+		if e.Record.TableName() != "runs" {
+			return nil
+		}
+		from, ok := e.HttpContext.Get(fromStatusKey).(string)
+		if !ok {
+			return nil
+		}
+		app.RecordRunEvent(e.Record.Id, from, e.Record.GetStringDataValue("status"), execution.SourceAPI, "")
+		return nil
+	})
+}
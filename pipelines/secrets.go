@@ -0,0 +1,125 @@
+package pipelines
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/labstack/echo/v5"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/tools/rest"
+	"github.com/rs/zerolog/log"
+	"github.com/supabase/supabench/internal/execution"
+	"github.com/supabase/supabench/internal/redact"
+)
+
+// InitSecrets validates and versions benchmark scripts when they are
+// uploaded. Archives that cannot be unpacked or contain no terraform
+// configuration are rejected, everything else is recorded as a new script
+// version and validated in the background with the report stored on the
+// secret.
+func InitSecrets(app *execution.App) {
+	app.PB.OnRecordBeforeCreateRequest().Add(func(e *core.RecordCreateEvent) error {
+		return checkUploadedScript(app, e.HttpContext, e.Record)
+	})
+	app.PB.OnRecordBeforeUpdateRequest().Add(func(e *core.RecordUpdateEvent) error {
+		return checkUploadedScript(app, e.HttpContext, e.Record)
+	})
+
+	app.PB.OnRecordAfterCreateRequest().Add(func(e *core.RecordCreateEvent) error {
+		scriptSaved(app, e.HttpContext, e.Record)
+		return nil
+	})
+	app.PB.OnRecordAfterUpdateRequest().Add(func(e *core.RecordUpdateEvent) error {
+		scriptSaved(app, e.HttpContext, e.Record)
+		return nil
+	})
+}
+
+func checkUploadedScript(app *execution.App, c echo.Context, record *models.Record) error {
+	if record.TableName() != "secrets" {
+		return nil
+	}
+
+	fh, err := c.FormFile("script")
+	if err != nil {
+		// no new script uploaded
+		return nil
+	}
+
+	dir, err := os.MkdirTemp("", "supabench-upload-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	src, err := fh.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	// keep the original name, it is used to identify the archive format
+	packedPath := filepath.Join(dir, filepath.Base(fh.Filename))
+	dst, err := os.Create(packedPath)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+	if _, err := io.Copy(dst, src); err != nil {
+		return err
+	}
+
+	if err := execution.CheckScript(packedPath, uploadRedactor(app, record)); err != nil {
+		return rest.NewBadRequestError("invalid benchmark script: "+err.Error(), nil)
+	}
+	return nil
+}
+
+// uploadRedactor knows the secret values stored so far and the ones sent
+// along with the upload.
+func uploadRedactor(app *execution.App, record *models.Record) *redact.Redactor {
+	r, _ := app.RedactorFor(record.GetStringDataValue("benchmark_id"))
+	for _, field := range []string{"env", "vars"} {
+		b, err := json.Marshal(record.GetDataValue(field))
+		if err != nil {
+			continue
+		}
+		values := map[string]string{}
+		if err := json.Unmarshal(b, &values); err == nil {
+			r.AddMap(values)
+		}
+	}
+	return r
+}
+
+func scriptSaved(app *execution.App, c echo.Context, record *models.Record) {
+	if record.TableName() != "secrets" || record.GetStringDataValue("script") == "" {
+		return
+	}
+
+	// the note is not a secrets field, it is only sent along with the upload
+	if _, err := app.RecordScriptVersion(record.Id, uploader(c), c.FormValue("script_note")); err != nil {
+		log.Error().Err(err).Str("secret_id", record.Id).Msg("error recording script version")
+	}
+
+	// terraform init may take a while, don't block the request
+	go func(id string) {
+		if _, err := app.ValidateSecret(id); err != nil {
+			log.Error().Err(err).Str("secret_id", id).Msg("error validating script")
+		}
+	}(record.Id)
+}
+
+func uploader(c echo.Context) string {
+	if admin, _ := c.Get(apis.ContextAdminKey).(*models.Admin); admin != nil {
+		return admin.Email
+	}
+	if user, _ := c.Get(apis.ContextUserKey).(*models.User); user != nil {
+		return user.Email
+	}
+	return ""
+}